@@ -117,12 +117,12 @@ func (s *shell) mainLoop() {
 	}
 }
 
-type dbFunc func(opts ...any) *prol.Database
+type dbFunc func(opts ...prol.SolveOption) (*prol.Database, error)
 
 var (
 	parsers = map[string]dbFunc{
-		"bootstrap":  func(opts ...any) *prol.Database { return prol.Bootstrap() },
-		"bootstrap2": func(opts ...any) *prol.Database { return prol.Bootstrap2() },
+		"bootstrap":  func(opts ...prol.SolveOption) (*prol.Database, error) { return prol.Bootstrap(), nil },
+		"bootstrap2": prol.Bootstrap2,
 		"prelude":    prol.Prelude,
 	}
 )
@@ -152,7 +152,10 @@ func parser() *prol.Database {
 	if !ok {
 		log.Fatalf("Invalid parser %q", parserName)
 	}
-	db := dbFn()
+	db, err := dbFn()
+	if err != nil {
+		log.Fatalf("Could not load parser %q: %v", parserName, err)
+	}
 	db.Logger = kif.NewStderrLogger()
 	db.Logger.LogLevel = kif.INFO
 	return db
@@ -5,10 +5,10 @@ go 1.23.0
 require (
 	github.com/ergochat/readline v0.1.3
 	github.com/google/go-cmp v0.7.0
+	google.golang.org/protobuf v1.36.6
 )
 
 require (
 	golang.org/x/sys v0.32.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
-	google.golang.org/protobuf v1.36.6 // indirect
 )
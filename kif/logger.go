@@ -9,10 +9,13 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"unicode/utf8"
 )
 
 type Logger struct {
+	// Guards writes to out, so that lines from concurrent callers are not interleaved.
+	mu          sync.Mutex
 	out         io.WriteCloser
 	shouldClose bool
 	encoder     logEncoder
@@ -132,13 +135,18 @@ func (l *Logger) Log(level LogLevel, kvs ...KV) {
 }
 
 func (l *Logger) log(level LogLevel, kvs ...KV) {
-	if l == nil || l.out == nil {
+	if l == nil {
 		return
 	}
 	if level < l.LogLevel {
 		// Filter logs below the minimum level.
 		return
 	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.out == nil {
+		return
+	}
 	l.startLine()
 	l.logEntry("level", level)
 	if !l.DisableCaller {
@@ -7,6 +7,9 @@ import (
 )
 
 func main() {
-	prelude := prol.Prelude()
+	prelude, err := prol.Prelude()
+	if err != nil {
+		panic(err)
+	}
 	fmt.Println(prelude)
 }
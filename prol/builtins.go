@@ -2,15 +2,41 @@ package prol
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"slices"
 	"strconv"
 )
 
+func trueBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return isSuccess(true)
+}
+
+func failBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return isSuccess(false)
+}
+
 func unifyBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1, arg2 := goal.Term.Args[0], goal.Term.Args[1]
 	return isSuccess(s.Unify(arg1, arg2))
 }
 
+func unifyWithOccursCheckBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	arg1, arg2 := goal.Term.Args[0], goal.Term.Args[1]
+	return isSuccess(s.UnifyWithOccursCheck(arg1, arg2))
+}
+
+// notUnifiableBuiltin implements ISO \=/2, succeeding if both terms don't unify.
+func notUnifiableBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	arg1, arg2 := goal.Term.Args[0], goal.Term.Args[1]
+	unwind := s.Unwind()
+	ok := s.Unify(arg1, arg2)
+	unwind()
+	return isSuccess(!ok)
+}
+
+// notEqualsBuiltin implements neq/2, succeeding only if both terms are different without
+// binding any ref. Unlike \==/2, it fails for terms that may become equal, like distinct refs.
 func notEqualsBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1, arg2 := goal.Term.Args[0], goal.Term.Args[1]
 	unwind := s.Unwind()
@@ -19,46 +45,69 @@ func notEqualsBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	return isSuccess(!ok && !didBind)
 }
 
-func gtBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
-	arg1, arg2 := Deref(goal.Term.Args[0]), Deref(goal.Term.Args[1])
-	i1, ok1 := arg1.(Int)
-	i2, ok2 := arg2.(Int)
-	if !ok1 || !ok2 {
-		return isError(fmt.Errorf(">/2: want Int < Int, got %T < %T", arg1, arg2))
+// termCompareBuiltin creates a builtin that compares both arguments in the standard order.
+func termCompareBuiltin(cmp func(c int) bool) func(Solver, Goal) ([]Goal, bool, error) {
+	return func(s Solver, goal Goal) ([]Goal, bool, error) {
+		return isSuccess(cmp(Compare(goal.Term.Args[0], goal.Term.Args[1])))
 	}
-	return isSuccess(int(i1) > int(i2))
 }
 
-func gteBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
-	arg1, arg2 := Deref(goal.Term.Args[0]), Deref(goal.Term.Args[1])
-	i1, ok1 := arg1.(Int)
-	i2, ok2 := arg2.(Int)
-	if !ok1 || !ok2 {
-		return isError(fmt.Errorf(">=/2: want Int >= Int, got %T >= %T", arg1, arg2))
-	}
-	return isSuccess(int(i1) >= int(i2))
+func identicalBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return isSuccess(isIdentical(goal.Term.Args[0], goal.Term.Args[1]))
+}
+
+func notIdenticalBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return isSuccess(!isIdentical(goal.Term.Args[0], goal.Term.Args[1]))
 }
 
-func ltBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
-	arg1, arg2 := Deref(goal.Term.Args[0]), Deref(goal.Term.Args[1])
-	i1, ok1 := arg1.(Int)
-	i2, ok2 := arg2.(Int)
-	if !ok1 || !ok2 {
-		return isError(fmt.Errorf("</2: want Int < Int, got %T < %T", arg1, arg2))
+var (
+	termLtBuiltin  = termCompareBuiltin(func(c int) bool { return c < 0 })
+	termLteBuiltin = termCompareBuiltin(func(c int) bool { return c <= 0 })
+	termGtBuiltin  = termCompareBuiltin(func(c int) bool { return c > 0 })
+	termGteBuiltin = termCompareBuiltin(func(c int) bool { return c >= 0 })
+)
+
+var orderAtoms = []Atom{"<", "=", ">"}
+
+func compareBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	order := Deref(goal.Term.Args[0])
+	switch o := order.(type) {
+	case *Ref:
+	case Atom:
+		if !slices.Contains(orderAtoms, o) {
+			return isError(domainError("order", o, goal.Term.Indicator()))
+		}
+	default:
+		return isError(typeError("atom", order, goal.Term.Indicator()))
 	}
-	return isSuccess(int(i1) < int(i2))
+	c := Compare(goal.Term.Args[1], goal.Term.Args[2])
+	return isSuccess(s.Unify(order, orderAtoms[c+1]))
 }
 
-func lteBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
-	arg1, arg2 := Deref(goal.Term.Args[0]), Deref(goal.Term.Args[1])
-	i1, ok1 := arg1.(Int)
-	i2, ok2 := arg2.(Int)
-	if !ok1 || !ok2 {
-		return isError(fmt.Errorf("=</2: want Int =< Int, got %T =< %T", arg1, arg2))
+// arithCompareBuiltin creates a builtin that evaluates both arguments and compares their values.
+func arithCompareBuiltin(cmp func(c int) bool) func(Solver, Goal) ([]Goal, bool, error) {
+	return func(s Solver, goal Goal) ([]Goal, bool, error) {
+		x, err := eval(goal.Term.Args[0], goal.Term.Indicator())
+		if err != nil {
+			return isError(err)
+		}
+		y, err := eval(goal.Term.Args[1], goal.Term.Indicator())
+		if err != nil {
+			return isError(err)
+		}
+		return isSuccess(cmp(compareNumbers(x, y)))
 	}
-	return isSuccess(int(i1) <= int(i2))
 }
 
+var (
+	gtBuiltin  = arithCompareBuiltin(func(c int) bool { return c > 0 })
+	gteBuiltin = arithCompareBuiltin(func(c int) bool { return c >= 0 })
+	ltBuiltin  = arithCompareBuiltin(func(c int) bool { return c < 0 })
+	lteBuiltin = arithCompareBuiltin(func(c int) bool { return c <= 0 })
+	eqBuiltin  = arithCompareBuiltin(func(c int) bool { return c == 0 })
+	neqBuiltin = arithCompareBuiltin(func(c int) bool { return c != 0 })
+)
+
 func atomBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	term := Deref(goal.Term.Args[0])
 	_, ok := term.(Atom)
@@ -67,10 +116,20 @@ func atomBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 
 func intBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	term := Deref(goal.Term.Args[0])
-	_, ok := term.(Int)
+	return isSuccess(isInteger(term))
+}
+
+func floatBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	term := Deref(goal.Term.Args[0])
+	_, ok := term.(Float)
 	return isSuccess(ok)
 }
 
+func numberBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	term := Deref(goal.Term.Args[0])
+	return isSuccess(isNumber(term))
+}
+
 func varBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	term := Deref(goal.Term.Args[0])
 	_, ok := term.(*Ref)
@@ -81,7 +140,7 @@ func atomToCharsBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
 	atom, ok := arg1.(Atom)
 	if !ok {
-		return isError(fmt.Errorf("atom_to_chars/2: arg #1: not an atom: %v", arg1))
+		return isError(typeOrInstantiationError("atom", arg1, goal.Term.Indicator()))
 	}
 	chars := make([]Term, len(atom))
 	for i, ch := range atom {
@@ -95,26 +154,19 @@ func charsToAtomBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
 	text, err := ToString(arg1)
 	if err != nil {
-		return isError(fmt.Errorf("chars_to_atom/2: arg #1: %w", err))
+		return isError(typeOrInstantiationError("list", arg1, goal.Term.Indicator()).withMessage(err.Error()))
 	}
 	return isSuccess(s.Unify(Atom(text), goal.Term.Args[1]))
 }
 
 func intToCharsBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
-	i, ok := arg1.(Int)
-	if !ok {
-		return isError(fmt.Errorf("int_to_chars/2: arg #1: not an int: %v", arg1))
+	if !isInteger(arg1) {
+		return isError(typeOrInstantiationError("integer", arg1, goal.Term.Indicator()))
 	}
 	var chars []Term
-	if i < 0 {
-		chars = append(chars, Atom("-"))
-		i = -i
-	}
-	for i > 0 {
-		a, b := i/10, i%10
-		chars = append(chars, Atom(strconv.Itoa(int(b))))
-		i = a
+	for _, ch := range arg1.String() {
+		chars = append(chars, Atom(ch))
 	}
 	term := FromList(chars)
 	return isSuccess(s.Unify(term, goal.Term.Args[1]))
@@ -124,20 +176,50 @@ func charsToIntBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
 	text, err := ToString(arg1)
 	if err != nil {
-		return isError(fmt.Errorf("chars_to_int/2: arg #1: %w", err))
+		return isError(typeOrInstantiationError("list", arg1, goal.Term.Indicator()).withMessage(err.Error()))
+	}
+	i, err := ParseInt(text)
+	if err != nil {
+		return isError(syntaxError("illegal_number", goal.Term.Indicator()).withMessage(err.Error()))
+	}
+	return isSuccess(s.Unify(i, goal.Term.Args[1]))
+}
+
+func floatToCharsBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	arg1 := Deref(goal.Term.Args[0])
+	f, ok := arg1.(Float)
+	if !ok {
+		return isError(typeOrInstantiationError("float", arg1, goal.Term.Indicator()))
+	}
+	var chars []Term
+	for _, ch := range f.String() {
+		chars = append(chars, Atom(ch))
+	}
+	term := FromList(chars)
+	return isSuccess(s.Unify(term, goal.Term.Args[1]))
+}
+
+func charsToFloatBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	arg1 := Deref(goal.Term.Args[0])
+	text, err := ToString(arg1)
+	if err != nil {
+		return isError(typeOrInstantiationError("list", arg1, goal.Term.Indicator()).withMessage(err.Error()))
 	}
-	i, err := strconv.Atoi(text)
+	f, err := strconv.ParseFloat(text, 64)
 	if err != nil {
-		return isError(fmt.Errorf("chars_to_int/2: arg #1: %w", err))
+		return isError(syntaxError("illegal_number", goal.Term.Indicator()).withMessage(err.Error()))
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return isError(syntaxError("illegal_number", goal.Term.Indicator()))
 	}
-	return isSuccess(s.Unify(Int(i), goal.Term.Args[1]))
+	return isSuccess(s.Unify(Float(f), goal.Term.Args[1]))
 }
 
 func atomLengthBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
 	atom, ok := arg1.(Atom)
 	if !ok {
-		return isError(fmt.Errorf("atom_length/2: arg #1: not an atom: %v", arg1))
+		return isError(typeOrInstantiationError("atom", arg1, goal.Term.Indicator()))
 	}
 	length := Int(len(atom))
 	return isSuccess(s.Unify(length, goal.Term.Args[1]))
@@ -147,7 +229,7 @@ func getPredicateBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
 	ind, err := CompileIndicator(arg1)
 	if err != nil {
-		return isError(fmt.Errorf("get_predicate/2: %w", err))
+		return isError(typeOrInstantiationError("predicate_indicator", arg1, goal.Term.Indicator()).withMessage(err.Error()))
 	}
 	rules := s.GetPredicate(ind)
 	terms := make([]Term, len(rules))
@@ -162,38 +244,305 @@ func putPredicateBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
 	ind, err := CompileIndicator(arg1)
 	if err != nil {
-		return isError(fmt.Errorf("put_predicate/2: arg #1: %w", err))
+		return isError(typeOrInstantiationError("predicate_indicator", arg1, goal.Term.Indicator()).withMessage(err.Error()))
 	}
-	rulesAST, tail := ToList(Deref(goal.Term.Args[1]))
+	arg2 := Deref(goal.Term.Args[1])
+	rulesAST, tail := ToList(arg2)
 	if tail != Nil {
-		return isError(fmt.Errorf("put_predicate/2: arg #2: not a proper list"))
+		return isError(typeOrInstantiationError("list", arg2, goal.Term.Indicator()))
 	}
 	rules := make([]Rule, len(rulesAST))
 	for i, ruleAST := range rulesAST {
 		rules[i], err = CompileRule(Deref(ruleAST))
 		if err != nil {
-			return isError(fmt.Errorf("put_predicate/2: rule #%d: %w", i+1, err))
+			return isError(typeOrInstantiationError("rule", ruleAST, goal.Term.Indicator()).withMessage(err.Error()))
 		}
 	}
 	return isSuccess(s.PutPredicate(ind, rules))
 }
 
 func assertzBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
-	arg1 := Deref(goal.Term.Args[0])
-	rule, err := CompileRule(arg1)
+	rule, err := toRule(goal.Term.Args[0], goal.Term.Indicator())
 	if err != nil {
-		return isError(fmt.Errorf("assertz/1: %w", err))
+		return isError(err)
 	}
-	if rule.Indicator() == (Indicator{"directive", 0}) {
+	if rule.Indicator() == (Indicator{Name: "directive", Arity: 0}) {
 		// Execute directive immediately.
 		// TODO: consider other rule types.
-		clause := varToRef(rule, map[Var]*Ref{}).(Clause)
+		clause := varToRef(rule, map[Var]*Ref{}, s.NewRef).(Clause)
 		return hasContinuation(clause[1:])
 	}
+	if err := checkModifiable(s, rule, goal.Term.Indicator()); err != nil {
+		return isError(err)
+	}
 	s.Assert(rule)
 	return isSuccess(true)
 }
 
+func assertaBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	rule, err := toRule(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	if err := checkModifiable(s, rule, goal.Term.Indicator()); err != nil {
+		return isError(err)
+	}
+	s.Asserta(rule)
+	return isSuccess(true)
+}
+
+// checkModifiable returns a permission error if the rule belongs to a builtin predicate or
+// control construct, that can't be modified by assertz/1 and asserta/1.
+func checkModifiable(s Solver, rule Rule, ctx Indicator) error {
+	if _, ind := moduleRule("", rule); s.IsStatic(ind) {
+		return permissionError("modify", "static_procedure", indicatorTerm(ind), ctx)
+	}
+	return nil
+}
+
+// toRule converts the argument of assertz/1 and asserta/1 into a rule. It accepts clause
+// terms like 'Head :- Body' or 'Head', like retract/1, and the AST of rules produced by the
+// parser. Both may be qualified with a module.
+func toRule(t Term, ctx Indicator) (Rule, error) {
+	module, t, err := unqualify(t, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ast, ok := t.(Struct); ok {
+		switch ast.Indicator() {
+		case Indicator{Name: "clause", Arity: 2}, Indicator{Name: "dcg", Arity: 2}:
+			if rule, err := CompileRule(ast); err == nil {
+				return qualifyRule(module, rule), nil
+			}
+		}
+	}
+	head, body := t, Term(Atom("true"))
+	if st, ok := t.(Struct); ok && st.Indicator() == (Indicator{Name: ":-", Arity: 2}) {
+		head, body = st.Args[0], st.Args[1]
+	}
+	g, err := toGoal(head, ctx)
+	if err != nil {
+		return nil, err
+	}
+	goals, err := bodyGoals(body, ctx)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[*Ref]Var)
+	c := make(Clause, len(goals)+1)
+	for i, goal := range append([]Goal{g}, goals...) {
+		c[i] = Goal{Term: refsToVars(goal.Term, vars).(Struct)}
+	}
+	return qualifyRule(module, c), nil
+}
+
+// bodyGoals flattens the conjunctions in a clause body into goals. Variables are called
+// with call/1.
+func bodyGoals(t Term, ctx Indicator) ([]Goal, error) {
+	switch t := Deref(t).(type) {
+	case *Ref:
+		return []Goal{{Term: Struct{"call", []Term{t}}}}, nil
+	case Atom:
+		if t == "true" {
+			return nil, nil
+		}
+		return []Goal{{Term: Struct{t, nil}}}, nil
+	case Struct:
+		if t.Indicator() != (Indicator{Name: ",", Arity: 2}) {
+			return []Goal{{Term: t}}, nil
+		}
+		first, err := bodyGoals(t.Args[0], ctx)
+		if err != nil {
+			return nil, err
+		}
+		rest, err := bodyGoals(t.Args[1], ctx)
+		if err != nil {
+			return nil, err
+		}
+		return append(first, rest...), nil
+	default:
+		return nil, typeError("callable", t, ctx)
+	}
+}
+
+// refsToVars replaces the unbound refs within t by vars, so that it may be stored in a rule.
+func refsToVars(t Term, vars map[*Ref]Var) Term {
+	switch t := Deref(t).(type) {
+	case *Ref:
+		if _, ok := vars[t]; !ok {
+			vars[t] = Var(fmt.Sprintf("_G%d", len(vars)))
+		}
+		return vars[t]
+	case Struct:
+		args := make([]Term, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = refsToVars(arg, vars)
+		}
+		return Struct{t.Name, args}
+	default:
+		return t
+	}
+}
+
+// qualifyRule qualifies the head of the rule with the module, so that it's asserted into
+// it. DCGs are converted to their clause.
+func qualifyRule(module Atom, rule Rule) Rule {
+	if module == "" {
+		return rule
+	}
+	var c Clause
+	switch r := rule.(type) {
+	case Clause:
+		c = r
+	case DCG:
+		c = r.clause
+	default:
+		return rule
+	}
+	head := Goal{Term: Struct{":", []Term{module, c[0].Term}}, LexerState: c[0].LexerState}
+	return slices.Concat(Clause{head}, c[1:])
+}
+
+// retractallBuiltin removes all clauses whose head unifies with the argument, declaring the
+// predicate as dynamic if it doesn't exist.
+func retractallBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	head, ind, err := toQualifiedGoal(goal.Term.Args[0], ctx)
+	if err != nil {
+		return isError(err)
+	}
+	if s.IsStatic(ind) {
+		return isError(permissionError("modify", "static_procedure", indicatorTerm(ind), ctx))
+	}
+	s.Dynamic(ind)
+	unwind := s.Unwind()
+	defer unwind()
+	for _, rule := range s.GetPredicate(ind) {
+		unwind()
+		_, ok, err := rule.Unify(s, head)
+		if err != nil {
+			return isError(err)
+		}
+		if ok {
+			s.Retract(ind, rule)
+		}
+	}
+	return isSuccess(true)
+}
+
+func abolishBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	ind, err := toIndicator(goal.Term.Args[0], ctx)
+	if err != nil {
+		return isError(err)
+	}
+	if s.IsStatic(ind) {
+		return isError(permissionError("modify", "static_procedure", indicatorTerm(ind), ctx))
+	}
+	s.Abolish(ind)
+	return isSuccess(true)
+}
+
+// currentPredicateBuiltin enumerates the indicators of user-defined predicates in a module,
+// given like 'Module:Name/Arity', or in the user module if not qualified.
+func currentPredicateBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	pi := Deref(goal.Term.Args[0])
+	module, spec, err := unqualify(pi, goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	switch t := spec.(type) {
+	case *Ref:
+	case Struct:
+		if t.Indicator() != (Indicator{Name: "/", Arity: 2}) {
+			return isError(typeError("predicate_indicator", pi, goal.Term.Indicator()))
+		}
+		switch Deref(t.Args[0]).(type) {
+		case Atom, *Ref:
+		default:
+			return isError(typeError("predicate_indicator", pi, goal.Term.Indicator()))
+		}
+		switch Deref(t.Args[1]).(type) {
+		case Int, *Ref:
+		default:
+			return isError(typeError("predicate_indicator", pi, goal.Term.Indicator()))
+		}
+	default:
+		return isError(typeError("predicate_indicator", pi, goal.Term.Indicator()))
+	}
+	var alternatives []Struct
+	for _, ind := range s.Predicates() {
+		if ind.Module != module || s.IsStatic(ind) {
+			continue
+		}
+		alternatives = append(alternatives, Struct{"=", []Term{spec, Struct{"/", []Term{ind.Name, Int(ind.Arity)}}}})
+	}
+	if len(alternatives) == 0 {
+		return isSuccess(false)
+	}
+	return hasContinuation([]Goal{{Term: disjunction(alternatives)}})
+}
+
+// predicateProperties returns the properties of a predicate, or nil if it doesn't exist.
+func predicateProperties(s Solver, ind Indicator) []Term {
+	if s.IsStatic(ind) {
+		return []Term{Atom("defined"), Atom("built_in"), Atom("static")}
+	}
+	if !s.PredicateExists(ind) {
+		return nil
+	}
+	rules := s.GetPredicate(ind)
+	kind := Atom("static")
+	if s.IsDynamic(ind) {
+		kind = "dynamic"
+	}
+	props := []Term{
+		Atom("defined"),
+		kind,
+		Struct{"number_of_clauses", []Term{Int(len(rules))}},
+	}
+	if slices.ContainsFunc(rules, func(rule Rule) bool { _, ok := rule.(DCG); return ok }) {
+		props = append(props, Atom("dcg"))
+	}
+	return props
+}
+
+// predicatePropertyBuiltin enumerates the properties of a predicate, or of all predicates if
+// the head is unbound.
+func predicatePropertyBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	head := Deref(goal.Term.Args[0])
+	var inds []Indicator
+	if _, ok := head.(*Ref); ok {
+		inds = s.Predicates()
+	} else {
+		_, ind, err := toQualifiedGoal(head, goal.Term.Indicator())
+		if err != nil {
+			return isError(err)
+		}
+		inds = []Indicator{ind}
+	}
+	pair := Struct{"-", goal.Term.Args}
+	var alternatives []Struct
+	for _, ind := range inds {
+		var generic Term = ind.Name
+		if ind.Arity > 0 {
+			args := make([]Term, ind.Arity)
+			for i := range args {
+				args[i] = s.NewRef("_")
+			}
+			generic = Struct{ind.Name, args}
+		}
+		generic = qualify(ind.Module, generic)
+		for _, prop := range predicateProperties(s, ind) {
+			alternatives = append(alternatives, Struct{"=", []Term{pair, Struct{"-", []Term{generic, prop}}}})
+		}
+	}
+	if len(alternatives) == 0 {
+		return isSuccess(false)
+	}
+	return hasContinuation([]Goal{{Term: disjunction(alternatives)}})
+}
+
 func printBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
 	fmt.Println(arg1)
@@ -201,22 +550,29 @@ func printBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 }
 
 func isBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
-	arg2, err := Eval(goal.Term.Args[1])
+	arg2, err := eval(goal.Term.Args[1], goal.Term.Indicator())
 	if err != nil {
-		return isError(fmt.Errorf("is/2: arg #2: %w", err))
+		return isError(err)
 	}
 	return isSuccess(s.Unify(goal.Term.Args[0], arg2))
 }
 
 func consultBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
-	bs, err := os.ReadFile(string(arg1.(Atom)))
+	path, ok := arg1.(Atom)
+	if !ok {
+		return isError(typeOrInstantiationError("atom", arg1, goal.Term.Indicator()))
+	}
+	bs, err := os.ReadFile(string(path))
 	if err != nil {
-		return isError(fmt.Errorf("consult/1: arg #1: %w", err))
+		return isError(existenceError("source_sink", path, goal.Term.Indicator()).withMessage(err.Error()))
 	}
 	err = s.Interpret(string(bs))
 	if err != nil {
-		return isError(fmt.Errorf("consult/1: arg #1: %w", err))
+		if _, ok := err.(*PrologError); ok {
+			return isError(err)
+		}
+		return isError(syntaxError("invalid_source", goal.Term.Indicator()).withMessage(err.Error()))
 	}
 	return isSuccess(true)
 }
@@ -225,7 +581,7 @@ func putBreakpointBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
 	ind, err := CompileIndicator(arg1)
 	if err != nil {
-		return isError(fmt.Errorf("put_breakpoint/2: arg #1: %w", err))
+		return isError(typeOrInstantiationError("predicate_indicator", arg1, goal.Term.Indicator()).withMessage(err.Error()))
 	}
 	return isSuccess(s.PutBreakpoint(ind))
 }
@@ -234,33 +590,631 @@ func clearBreakpointBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
 	arg1 := Deref(goal.Term.Args[0])
 	ind, err := CompileIndicator(arg1)
 	if err != nil {
-		return isError(fmt.Errorf("clear_breakpoint/2: arg #1: %w", err))
+		return isError(typeOrInstantiationError("predicate_indicator", arg1, goal.Term.Indicator()).withMessage(err.Error()))
 	}
 	return isSuccess(s.ClearBreakpoint(ind))
 }
 
+func throwBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ball := Deref(goal.Term.Args[0])
+	if _, ok := ball.(*Ref); ok {
+		return isError(instantiationError(goal.Term.Indicator()))
+	}
+	// Copy ball, since bindings are undone until reaching a catch goal.
+	return isError(&PrologError{copyTerm(ball, make(map[*Ref]*Ref), s.NewRef)})
+}
+
+func findallBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	template, g, bag := goal.Term.Args[0], goal.Term.Args[1], goal.Term.Args[2]
+	results, err := s.FindAll(template, g)
+	if err != nil {
+		return isError(err)
+	}
+	return isSuccess(s.Unify(FromList(results), bag))
+}
+
+func bagofBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return bagof(s, goal, false)
+}
+
+func setofBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return bagof(s, goal, true)
+}
+
+// bagof collects the solutions of a goal, grouped by the bindings of its free variables.
+//
+// Free variables are those that don't appear in the template, nor are existentially
+// quantified with ^/2, like in 'Y^foo(X, Y)'. Each group is returned on backtracking.
+// If isSet is true, each group is sorted and has its duplicates removed.
+func bagof(s Solver, goal Goal, isSet bool) ([]Goal, bool, error) {
+	template, g, bag := goal.Term.Args[0], Deref(goal.Term.Args[1]), goal.Term.Args[2]
+	// Strip existential quantifiers.
+	bound := []Term{template}
+	for {
+		st, ok := g.(Struct)
+		if !ok || st.Indicator() != (Indicator{Name: "^", Arity: 2}) {
+			break
+		}
+		bound = append(bound, st.Args[0])
+		g = Deref(st.Args[1])
+	}
+	isBound := make(map[*Ref]bool)
+	for _, ref := range termVariables(FromList(bound)) {
+		isBound[ref] = true
+	}
+	var free []Term
+	for _, ref := range termVariables(g) {
+		if !isBound[ref] {
+			free = append(free, ref)
+		}
+	}
+	witness := Struct{"$witness", free}
+	results, err := s.FindAll(Struct{"-", []Term{witness, template}}, g)
+	if err != nil {
+		return isError(err)
+	}
+	// Group results by witness, in order of first appearance.
+	var witnesses []Term
+	var groups [][]Term
+	for _, result := range results {
+		pair := result.(Struct)
+		w, t := pair.Args[0], pair.Args[1]
+		i := slices.IndexFunc(witnesses, func(x Term) bool { return isVariant(x, w) })
+		if i < 0 {
+			i = len(witnesses)
+			witnesses = append(witnesses, w)
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], t)
+	}
+	if len(groups) == 0 {
+		return isSuccess(false)
+	}
+	alternatives := make([]Struct, len(groups))
+	for i, group := range groups {
+		if isSet {
+			slices.SortStableFunc(group, Compare)
+			group = slices.CompactFunc(group, func(a, b Term) bool { return Compare(a, b) == 0 })
+		}
+		alternatives[i] = Struct{",", []Term{
+			Struct{"=", []Term{witness, witnesses[i]}},
+			Struct{"=", []Term{bag, FromList(group)}},
+		}}
+	}
+	return hasContinuation([]Goal{{Term: disjunction(alternatives)}})
+}
+
+func existsBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	g, err := toGoal(goal.Term.Args[1], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	return hasContinuation([]Goal{g})
+}
+
+func forallBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	cond, action := goal.Term.Args[0], goal.Term.Args[1]
+	// forall(Cond, Action) :- \+ (Cond, \+ Action).
+	notAction := Struct{"\\+", []Term{action}}
+	return hasContinuation([]Goal{{Term: Struct{"\\+", []Term{Struct{",", []Term{cond, notAction}}}}}})
+}
+
+// toProperList converts a proper list into a slice, returning an error if it's a partial list
+// or not a list.
+func toProperList(t Term, ctx Indicator) ([]Term, error) {
+	t = Deref(t)
+	terms, tail := ToList(t)
+	switch tail := tail.(type) {
+	case *Ref:
+		// A bound ref as tail means the list is cyclic.
+		if tail.Value == nil {
+			return nil, instantiationError(ctx)
+		}
+	case Atom:
+		if tail == Nil {
+			return terms, nil
+		}
+	}
+	return nil, typeError("list", t, ctx)
+}
+
+func sortBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	items, err := toProperList(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	slices.SortStableFunc(items, Compare)
+	items = slices.CompactFunc(items, func(a, b Term) bool { return Compare(a, b) == 0 })
+	return isSuccess(s.Unify(FromList(items), goal.Term.Args[1]))
+}
+
+func msortBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	items, err := toProperList(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	slices.SortStableFunc(items, Compare)
+	return isSuccess(s.Unify(FromList(items), goal.Term.Args[1]))
+}
+
+func keysortBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	items, err := toProperList(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	for i, item := range items {
+		item = Deref(item)
+		pair, ok := item.(Struct)
+		if !ok || pair.Indicator() != (Indicator{Name: "-", Arity: 2}) {
+			return isError(typeOrInstantiationError("pair", item, goal.Term.Indicator()))
+		}
+		items[i] = pair
+	}
+	slices.SortStableFunc(items, func(a, b Term) int {
+		return Compare(a.(Struct).Args[0], b.(Struct).Args[0])
+	})
+	return isSuccess(s.Unify(FromList(items), goal.Term.Args[1]))
+}
+
+func predsortBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	pred := goal.Term.Args[0]
+	items, err := toProperList(goal.Term.Args[1], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	// Calls 'call(Pred, Order, A, B)' once, like '(Goal -> true)', and returns the order as
+	// an int. Other solutions of the comparison are not executed.
+	order := func(a, b Term) (int, bool, error) {
+		o := s.NewRef("Order")
+		call := Struct{"call", []Term{pred, o, a, b}}
+		results, err := s.FindAll(o, Struct{"->", []Term{call, Atom("true")}})
+		if err != nil || len(results) == 0 {
+			return 0, false, err
+		}
+		c := -1
+		if atom, ok := results[0].(Atom); ok {
+			c = slices.Index(orderAtoms, atom)
+		}
+		if c < 0 {
+			return 0, false, domainError("order", results[0], goal.Term.Indicator())
+		}
+		return c - 1, true, nil
+	}
+	items, ok, err := predMergeSort(items, order)
+	if err != nil {
+		return isError(err)
+	}
+	if !ok {
+		return isSuccess(false)
+	}
+	return isSuccess(s.Unify(FromList(items), goal.Term.Args[2]))
+}
+
+// predMergeSort sorts items with a fallible comparison function, removing items that
+// compare equal to a previous one.
+func predMergeSort(items []Term, order func(a, b Term) (int, bool, error)) ([]Term, bool, error) {
+	if len(items) <= 1 {
+		return items, true, nil
+	}
+	mid := len(items) / 2
+	left, ok, err := predMergeSort(items[:mid], order)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	right, ok, err := predMergeSort(items[mid:], order)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	merged := make([]Term, 0, len(left)+len(right))
+	i, j := 0, 0
+	for i < len(left) && j < len(right) {
+		c, ok, err := order(left[i], right[j])
+		if !ok || err != nil {
+			return nil, ok, err
+		}
+		switch {
+		case c < 0:
+			merged = append(merged, left[i])
+			i++
+		case c > 0:
+			merged = append(merged, right[j])
+			j++
+		default:
+			merged = append(merged, left[i])
+			i++
+			j++
+		}
+	}
+	merged = append(merged, left[i:]...)
+	merged = append(merged, right[j:]...)
+	return merged, true, nil
+}
+
+// --- Term inspection ---
+
+func acyclicTermBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return isSuccess(isAcyclic(goal.Term.Args[0]))
+}
+
+func cyclicTermBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return isSuccess(!isAcyclic(goal.Term.Args[0]))
+}
+
+// isAtomic returns whether the term is an atom or a number.
+func isAtomic(t Term) bool {
+	_, ok := t.(Atom)
+	return ok || isNumber(t)
+}
+
+func functorBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	t, name, arity := Deref(goal.Term.Args[0]), Deref(goal.Term.Args[1]), Deref(goal.Term.Args[2])
+	switch t := t.(type) {
+	case Struct:
+		return isSuccess(s.Unify(name, t.Name) && s.Unify(arity, Int(len(t.Args))))
+	case *Ref:
+	default:
+		return isSuccess(s.Unify(name, t) && s.Unify(arity, Int(0)))
+	}
+	if _, ok := name.(*Ref); ok {
+		return isError(instantiationError(ctx))
+	}
+	n, ok := arity.(Int)
+	if !ok {
+		return isError(typeOrInstantiationError("integer", arity, ctx))
+	}
+	if n < 0 {
+		return isError(domainError("not_less_than_zero", arity, ctx))
+	}
+	if !isAtomic(name) {
+		return isError(typeError("atomic", name, ctx))
+	}
+	if n == 0 {
+		return isSuccess(s.Unify(t, name))
+	}
+	atom, ok := name.(Atom)
+	if !ok {
+		return isError(typeError("atom", name, ctx))
+	}
+	args := make([]Term, n)
+	for i := range args {
+		args[i] = s.NewRef("_")
+	}
+	return isSuccess(s.Unify(t, Struct{atom, args}))
+}
+
+func argBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	n, t, arg := Deref(goal.Term.Args[0]), Deref(goal.Term.Args[1]), goal.Term.Args[2]
+	st, ok := t.(Struct)
+	if !ok {
+		return isError(typeOrInstantiationError("compound", t, ctx))
+	}
+	switch n := n.(type) {
+	case Int:
+		if n < 1 || int(n) > len(st.Args) {
+			return isSuccess(false)
+		}
+		return isSuccess(s.Unify(arg, st.Args[n-1]))
+	case BigInt:
+		return isSuccess(false)
+	case *Ref:
+		if len(st.Args) == 0 {
+			return isSuccess(false)
+		}
+		// Enumerate all arguments on backtracking.
+		alternatives := make([]Struct, len(st.Args))
+		for i, x := range st.Args {
+			alternatives[i] = Struct{",", []Term{
+				Struct{"=", []Term{n, Int(i + 1)}},
+				Struct{"=", []Term{arg, x}},
+			}}
+		}
+		return hasContinuation([]Goal{{Term: disjunction(alternatives)}})
+	default:
+		return isError(typeError("integer", n, ctx))
+	}
+}
+
+func univBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	t, list := Deref(goal.Term.Args[0]), goal.Term.Args[1]
+	switch t := t.(type) {
+	case Struct:
+		return isSuccess(s.Unify(list, FromList(append([]Term{t.Name}, t.Args...))))
+	case *Ref:
+	default:
+		return isSuccess(s.Unify(list, FromList([]Term{t})))
+	}
+	items, err := toProperList(list, ctx)
+	if err != nil {
+		return isError(err)
+	}
+	if len(items) == 0 {
+		return isError(domainError("non_empty_list", Nil, ctx))
+	}
+	name := Deref(items[0])
+	if _, ok := name.(*Ref); ok {
+		return isError(instantiationError(ctx))
+	}
+	if !isAtomic(name) {
+		return isError(typeError("atomic", name, ctx))
+	}
+	if len(items) == 1 {
+		return isSuccess(s.Unify(t, name))
+	}
+	atom, ok := name.(Atom)
+	if !ok {
+		return isError(typeError("atom", name, ctx))
+	}
+	return isSuccess(s.Unify(t, Struct{atom, items[1:]}))
+}
+
+func copyTermBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	t := copyTerm(goal.Term.Args[0], make(map[*Ref]*Ref), s.NewRef)
+	return isSuccess(s.Unify(t, goal.Term.Args[1]))
+}
+
+func termVariablesBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	refs := termVariables(goal.Term.Args[0])
+	vars := make([]Term, len(refs))
+	for i, ref := range refs {
+		vars[i] = ref
+	}
+	return isSuccess(s.Unify(FromList(vars), goal.Term.Args[1]))
+}
+
+// toSetargArgs validates the arguments of setarg/3 and nb_setarg/3, returning whether
+// the index is within the struct's arguments.
+func toSetargArgs(goal Goal) (int, Struct, bool, error) {
+	ctx := goal.Term.Indicator()
+	n, t := Deref(goal.Term.Args[0]), Deref(goal.Term.Args[1])
+	if !isInteger(n) {
+		return 0, Struct{}, false, typeOrInstantiationError("integer", n, ctx)
+	}
+	st, ok := t.(Struct)
+	if !ok {
+		return 0, Struct{}, false, typeOrInstantiationError("compound", t, ctx)
+	}
+	i, ok := n.(Int)
+	if !ok || i < 1 || int(i) > len(st.Args) {
+		return 0, Struct{}, false, nil
+	}
+	return int(i), st, true, nil
+}
+
+func setargBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	n, st, ok, err := toSetargArgs(goal)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	s.SetArg(st, n, goal.Term.Args[2])
+	return isSuccess(true)
+}
+
+func nbSetargBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	n, st, ok, err := toSetargArgs(goal)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	// The value is copied so that it survives backtracking over its bindings.
+	st.Args[n-1] = copyTerm(goal.Term.Args[2], make(map[*Ref]*Ref), s.NewRef)
+	return isSuccess(true)
+}
+
+// toIndicator converts a term like 'Name/Arity' or 'Module:Name/Arity' into an indicator.
+func toIndicator(t Term, ctx Indicator) (Indicator, error) {
+	module, t, err := unqualify(t, ctx)
+	if err != nil {
+		return Indicator{}, err
+	}
+	if _, ok := t.(*Ref); ok {
+		return Indicator{}, instantiationError(ctx)
+	}
+	spec, ok := t.(Struct)
+	if !ok || spec.Indicator() != (Indicator{Name: "/", Arity: 2}) {
+		return Indicator{}, typeError("predicate_indicator", t, ctx)
+	}
+	nameArg, arityArg := Deref(spec.Args[0]), Deref(spec.Args[1])
+	name, ok := nameArg.(Atom)
+	if !ok {
+		return Indicator{}, typeOrInstantiationError("atom", nameArg, ctx)
+	}
+	arity, ok := arityArg.(Int)
+	if !ok {
+		return Indicator{}, typeOrInstantiationError("integer", arityArg, ctx)
+	}
+	if arity < 0 {
+		return Indicator{}, domainError("not_less_than_zero", arity, ctx)
+	}
+	return Indicator{Name: name, Arity: int(arity), Module: module}, nil
+}
+
+// toIndicators converts a predicate indicator, or a list or conjunction of them. A module
+// qualifying the list applies to all its indicators.
+func toIndicators(t Term, ctx Indicator) ([]Indicator, error) {
+	module, t, err := unqualify(t, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := t.(Struct); ok {
+		switch s.Indicator() {
+		case Indicator{Name: ",", Arity: 2}, Indicator{Name: ".", Arity: 2}:
+			first, err := toIndicators(qualify(module, s.Args[0]), ctx)
+			if err != nil {
+				return nil, err
+			}
+			rest, err := toIndicators(qualify(module, s.Args[1]), ctx)
+			if err != nil {
+				return nil, err
+			}
+			return append(first, rest...), nil
+		}
+	}
+	if t == Nil {
+		return nil, nil
+	}
+	ind, err := toIndicator(qualify(module, t), ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []Indicator{ind}, nil
+}
+
+func dynamicBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	inds, err := toIndicators(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	for _, ind := range inds {
+		s.Dynamic(ind)
+	}
+	return isSuccess(true)
+}
+
+func setPrologFlagBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	module, arg1, err := unqualify(goal.Term.Args[0], ctx)
+	if err != nil {
+		return isError(err)
+	}
+	name, ok := arg1.(Atom)
+	if !ok {
+		return isError(typeOrInstantiationError("atom", arg1, ctx))
+	}
+	if err := s.SetFlag(module, name, goal.Term.Args[1]); err != nil {
+		return isError(err)
+	}
+	return isSuccess(true)
+}
+
+var prologFlags = []Atom{"unknown", "occurs_check"}
+
+func currentPrologFlagBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	module, arg1, err := unqualify(goal.Term.Args[0], ctx)
+	if err != nil {
+		return isError(err)
+	}
+	switch arg1.(type) {
+	case Atom, *Ref:
+	default:
+		return isError(typeError("atom", arg1, ctx))
+	}
+	pair := Struct{"-", []Term{arg1, goal.Term.Args[1]}}
+	var alternatives []Struct
+	for _, name := range prologFlags {
+		value, _ := s.Flag(module, name)
+		alternatives = append(alternatives, Struct{"=", []Term{pair, Struct{"-", []Term{name, value}}}})
+	}
+	return hasContinuation([]Goal{{Term: disjunction(alternatives)}})
+}
+
 var builtins = []Builtin{
-	Builtin{Indicator{"=", 2}, unifyBuiltin},
-	Builtin{Indicator{"neq", 2}, notEqualsBuiltin},
-	Builtin{Indicator{"\\==", 2}, notEqualsBuiltin},
-	Builtin{Indicator{">", 2}, gtBuiltin},
-	Builtin{Indicator{">=", 2}, gteBuiltin},
-	Builtin{Indicator{"<", 2}, ltBuiltin},
-	Builtin{Indicator{"=<", 2}, lteBuiltin},
-	Builtin{Indicator{"atom", 1}, atomBuiltin},
-	Builtin{Indicator{"int", 1}, intBuiltin},
-	Builtin{Indicator{"var", 1}, varBuiltin},
-	Builtin{Indicator{"atom_to_chars", 2}, atomToCharsBuiltin},
-	Builtin{Indicator{"chars_to_atom", 2}, charsToAtomBuiltin},
-	Builtin{Indicator{"int_to_chars", 2}, intToCharsBuiltin},
-	Builtin{Indicator{"chars_to_int", 2}, charsToIntBuiltin},
-	Builtin{Indicator{"atom_length", 2}, atomLengthBuiltin},
-	Builtin{Indicator{"get_predicate", 2}, getPredicateBuiltin},
-	Builtin{Indicator{"put_predicate", 2}, putPredicateBuiltin},
-	Builtin{Indicator{"assertz", 1}, assertzBuiltin},
-	Builtin{Indicator{"print", 1}, printBuiltin},
-	Builtin{Indicator{"is", 2}, isBuiltin},
-	Builtin{Indicator{"consult", 1}, consultBuiltin},
-	Builtin{Indicator{"put_breakpoint", 1}, putBreakpointBuiltin},
-	Builtin{Indicator{"clear_breakpoint", 1}, clearBreakpointBuiltin},
+	Builtin{Indicator{Name: "true", Arity: 0}, trueBuiltin},
+	Builtin{Indicator{Name: "fail", Arity: 0}, failBuiltin},
+	Builtin{Indicator{Name: "false", Arity: 0}, failBuiltin},
+	Builtin{Indicator{Name: "=", Arity: 2}, unifyBuiltin},
+	Builtin{Indicator{Name: "unify_with_occurs_check", Arity: 2}, unifyWithOccursCheckBuiltin},
+	Builtin{Indicator{Name: "\\=", Arity: 2}, notUnifiableBuiltin},
+	Builtin{Indicator{Name: "neq", Arity: 2}, notEqualsBuiltin},
+	Builtin{Indicator{Name: "==", Arity: 2}, identicalBuiltin},
+	Builtin{Indicator{Name: "\\==", Arity: 2}, notIdenticalBuiltin},
+	Builtin{Indicator{Name: "@<", Arity: 2}, termLtBuiltin},
+	Builtin{Indicator{Name: "@=<", Arity: 2}, termLteBuiltin},
+	Builtin{Indicator{Name: "@>", Arity: 2}, termGtBuiltin},
+	Builtin{Indicator{Name: "@>=", Arity: 2}, termGteBuiltin},
+	Builtin{Indicator{Name: "compare", Arity: 3}, compareBuiltin},
+	Builtin{Indicator{Name: ">", Arity: 2}, gtBuiltin},
+	Builtin{Indicator{Name: ">=", Arity: 2}, gteBuiltin},
+	Builtin{Indicator{Name: "<", Arity: 2}, ltBuiltin},
+	Builtin{Indicator{Name: "=<", Arity: 2}, lteBuiltin},
+	Builtin{Indicator{Name: "=:=", Arity: 2}, eqBuiltin},
+	Builtin{Indicator{Name: "=\\=", Arity: 2}, neqBuiltin},
+	Builtin{Indicator{Name: "atom", Arity: 1}, atomBuiltin},
+	Builtin{Indicator{Name: "int", Arity: 1}, intBuiltin},
+	Builtin{Indicator{Name: "float", Arity: 1}, floatBuiltin},
+	Builtin{Indicator{Name: "number", Arity: 1}, numberBuiltin},
+	Builtin{Indicator{Name: "var", Arity: 1}, varBuiltin},
+	Builtin{Indicator{Name: "acyclic_term", Arity: 1}, acyclicTermBuiltin},
+	Builtin{Indicator{Name: "cyclic_term", Arity: 1}, cyclicTermBuiltin},
+	Builtin{Indicator{Name: "functor", Arity: 3}, functorBuiltin},
+	Builtin{Indicator{Name: "arg", Arity: 3}, argBuiltin},
+	Builtin{Indicator{Name: "=..", Arity: 2}, univBuiltin},
+	Builtin{Indicator{Name: "copy_term", Arity: 2}, copyTermBuiltin},
+	Builtin{Indicator{Name: "term_variables", Arity: 2}, termVariablesBuiltin},
+	Builtin{Indicator{Name: "setarg", Arity: 3}, setargBuiltin},
+	Builtin{Indicator{Name: "nb_setarg", Arity: 3}, nbSetargBuiltin},
+	Builtin{Indicator{Name: "b_setval", Arity: 2}, bSetvalBuiltin},
+	Builtin{Indicator{Name: "b_getval", Arity: 2}, getvalBuiltin},
+	Builtin{Indicator{Name: "nb_setval", Arity: 2}, nbSetvalBuiltin},
+	Builtin{Indicator{Name: "nb_getval", Arity: 2}, getvalBuiltin},
+	Builtin{Indicator{Name: "flag", Arity: 3}, flagBuiltin},
+	Builtin{Indicator{Name: "succ", Arity: 2}, succBuiltin},
+	Builtin{Indicator{Name: "atom_to_chars", Arity: 2}, atomToCharsBuiltin},
+	Builtin{Indicator{Name: "chars_to_atom", Arity: 2}, charsToAtomBuiltin},
+	Builtin{Indicator{Name: "int_to_chars", Arity: 2}, intToCharsBuiltin},
+	Builtin{Indicator{Name: "chars_to_int", Arity: 2}, charsToIntBuiltin},
+	Builtin{Indicator{Name: "float_to_chars", Arity: 2}, floatToCharsBuiltin},
+	Builtin{Indicator{Name: "chars_to_float", Arity: 2}, charsToFloatBuiltin},
+	Builtin{Indicator{Name: "atom_length", Arity: 2}, atomLengthBuiltin},
+	Builtin{Indicator{Name: "get_predicate", Arity: 2}, getPredicateBuiltin},
+	Builtin{Indicator{Name: "put_predicate", Arity: 2}, putPredicateBuiltin},
+	Builtin{Indicator{Name: "assertz", Arity: 1}, assertzBuiltin},
+	Builtin{Indicator{Name: "asserta", Arity: 1}, assertaBuiltin},
+	Builtin{Indicator{Name: "retractall", Arity: 1}, retractallBuiltin},
+	Builtin{Indicator{Name: "abolish", Arity: 1}, abolishBuiltin},
+	Builtin{Indicator{Name: "current_predicate", Arity: 1}, currentPredicateBuiltin},
+	Builtin{Indicator{Name: "predicate_property", Arity: 2}, predicatePropertyBuiltin},
+	Builtin{Indicator{Name: "module", Arity: 2}, moduleBuiltin},
+	Builtin{Indicator{Name: "use_module", Arity: 1}, useModuleBuiltin},
+	Builtin{Indicator{Name: "use_module", Arity: 2}, useModuleBuiltin},
+	Builtin{Indicator{Name: "print", Arity: 1}, printBuiltin},
+	Builtin{Indicator{Name: "is", Arity: 2}, isBuiltin},
+	Builtin{Indicator{Name: "consult", Arity: 1}, consultBuiltin},
+	Builtin{Indicator{Name: "put_breakpoint", Arity: 1}, putBreakpointBuiltin},
+	Builtin{Indicator{Name: "clear_breakpoint", Arity: 1}, clearBreakpointBuiltin},
+	Builtin{Indicator{Name: "throw", Arity: 1}, throwBuiltin},
+	Builtin{Indicator{Name: "findall", Arity: 3}, findallBuiltin},
+	Builtin{Indicator{Name: "bagof", Arity: 3}, bagofBuiltin},
+	Builtin{Indicator{Name: "setof", Arity: 3}, setofBuiltin},
+	Builtin{Indicator{Name: "^", Arity: 2}, existsBuiltin},
+	Builtin{Indicator{Name: "forall", Arity: 2}, forallBuiltin},
+	Builtin{Indicator{Name: "sort", Arity: 2}, sortBuiltin},
+	Builtin{Indicator{Name: "msort", Arity: 2}, msortBuiltin},
+	Builtin{Indicator{Name: "keysort", Arity: 2}, keysortBuiltin},
+	Builtin{Indicator{Name: "predsort", Arity: 3}, predsortBuiltin},
+	Builtin{Indicator{Name: "put_attr", Arity: 3}, putAttrBuiltin},
+	Builtin{Indicator{Name: "get_attr", Arity: 3}, getAttrBuiltin},
+	Builtin{Indicator{Name: "del_attr", Arity: 2}, delAttrBuiltin},
+	Builtin{Indicator{Name: "freeze", Arity: 2}, freezeBuiltin},
+	Builtin{Indicator{Name: "frozen", Arity: 2}, frozenBuiltin},
+	Builtin{Indicator{Name: "$freeze_hook", Arity: 2}, freezeHookBuiltin},
+	Builtin{Indicator{Name: "dif", Arity: 2}, difBuiltin},
+	Builtin{Indicator{Name: "$dif_hook", Arity: 2}, difHookBuiltin},
+	Builtin{Indicator{Name: "when", Arity: 2}, whenBuiltin},
+	Builtin{Indicator{Name: "$when", Arity: 3}, whenCheckBuiltin},
+	Builtin{Indicator{Name: "$when_hook", Arity: 2}, whenHookBuiltin},
+	Builtin{Indicator{Name: "#=", Arity: 2}, fdEqBuiltin},
+	Builtin{Indicator{Name: "#\\=", Arity: 2}, fdNeqBuiltin},
+	Builtin{Indicator{Name: "#<", Arity: 2}, fdLtBuiltin},
+	Builtin{Indicator{Name: "#=<", Arity: 2}, fdLteBuiltin},
+	Builtin{Indicator{Name: "#>", Arity: 2}, fdGtBuiltin},
+	Builtin{Indicator{Name: "#>=", Arity: 2}, fdGteBuiltin},
+	Builtin{Indicator{Name: "in", Arity: 2}, inBuiltin},
+	Builtin{Indicator{Name: "ins", Arity: 2}, insBuiltin},
+	Builtin{Indicator{Name: "all_different", Arity: 1}, allDifferentBuiltin},
+	Builtin{Indicator{Name: "all_distinct", Arity: 1}, allDifferentBuiltin},
+	Builtin{Indicator{Name: "sum", Arity: 3}, sumBuiltin},
+	Builtin{Indicator{Name: "label", Arity: 1}, labelBuiltin},
+	Builtin{Indicator{Name: "labeling", Arity: 2}, labelingBuiltin},
+	Builtin{Indicator{Name: "$label", Arity: 2}, labelStepBuiltin},
+	Builtin{Indicator{Name: "$clpfd_hook", Arity: 2}, clpfdHookBuiltin},
+	Builtin{Indicator{Name: "fd_dom", Arity: 2}, fdDomBuiltin},
+	Builtin{Indicator{Name: "fd_inf", Arity: 2}, fdInfBuiltin},
+	Builtin{Indicator{Name: "fd_sup", Arity: 2}, fdSupBuiltin},
+	Builtin{Indicator{Name: "dynamic", Arity: 1}, dynamicBuiltin},
+	Builtin{Indicator{Name: "table", Arity: 1}, tableBuiltin},
+	Builtin{Indicator{Name: "set_prolog_flag", Arity: 2}, setPrologFlagBuiltin},
+	Builtin{Indicator{Name: "current_prolog_flag", Arity: 2}, currentPrologFlagBuiltin},
 }
@@ -0,0 +1,1063 @@
+package prol
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// --- CLP(FD): constraint logic programming over finite domains ---
+//
+// Each constrained ref has a 'clpfd' attribute like '$fd'(Domain, Propagators), where Domain
+// is a list of 'Lo..Hi' intervals, and Propagators is the list of constraints over the ref.
+// Posting a constraint attaches its propagator to all refs in it, and runs the propagators
+// until reaching a fixpoint, narrowing the bounds of each domain. Refs whose domain becomes
+// a single value are bound to it.
+//
+// Propagators are terms like:
+//
+//   - '$fd_lin'(Cs, Xs, Op, C): the linear constraint 'sum(Cs[i]*Xs[i]) Op C', where Op
+//     is one of '=', '=<' or '\='.
+//   - '$fd_times'(X, Y, Z): the constraint 'X*Y = Z'.
+//   - '$fd_alldiff'(Xs): all terms in Xs are different.
+
+const (
+	fdInf = math.MinInt
+	fdSup = math.MaxInt
+	// Maximum number of propagator executions in a single fixpoint, after which a resource
+	// error is raised. This prevents slow convergence of constraints like 'X #> Y, Y #> X'
+	// over large domains.
+	fdMaxSteps = 100000
+)
+
+// fdInterval is a closed interval of integers, where lo may be fdInf and hi may be fdSup.
+type fdInterval struct {
+	lo, hi int
+}
+
+// fdDomain is a sorted list of disjoint and non-adjacent intervals.
+type fdDomain []fdInterval
+
+var fdFull = fdDomain{{fdInf, fdSup}}
+
+func (d fdDomain) isEmpty() bool     { return len(d) == 0 }
+func (d fdDomain) min() int          { return d[0].lo }
+func (d fdDomain) max() int          { return d[len(d)-1].hi }
+func (d fdDomain) isSingleton() bool { return len(d) == 1 && d[0].lo == d[0].hi }
+func (d fdDomain) isFinite() bool    { return d.min() != fdInf && d.max() != fdSup }
+
+func (d fdDomain) contains(x int) bool {
+	for _, in := range d {
+		if in.lo <= x && x <= in.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// size returns the number of values in the domain, saturating at fdSup.
+func (d fdDomain) size() int {
+	n := 0
+	for _, in := range d {
+		k, ok := subOK(in.hi, in.lo)
+		if !ok || k == fdSup {
+			return fdSup
+		}
+		if n, ok = addOK(n, k+1); !ok {
+			return fdSup
+		}
+	}
+	return n
+}
+
+func (d fdDomain) intersect(e fdDomain) fdDomain {
+	var result fdDomain
+	i, j := 0, 0
+	for i < len(d) && j < len(e) {
+		lo, hi := max(d[i].lo, e[j].lo), min(d[i].hi, e[j].hi)
+		if lo <= hi {
+			result = append(result, fdInterval{lo, hi})
+		}
+		if d[i].hi < e[j].hi {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+func (d fdDomain) union(e fdDomain) fdDomain {
+	all := slices.Concat(d, e)
+	slices.SortFunc(all, func(a, b fdInterval) int { return cmp.Compare(a.lo, b.lo) })
+	var result fdDomain
+	for _, in := range all {
+		n := len(result)
+		if n > 0 && (result[n-1].hi == fdSup || in.lo <= result[n-1].hi+1) {
+			result[n-1].hi = max(result[n-1].hi, in.hi)
+			continue
+		}
+		result = append(result, in)
+	}
+	return result
+}
+
+func (d fdDomain) restrict(lo, hi int) fdDomain {
+	if lo > hi {
+		return nil
+	}
+	return d.intersect(fdDomain{{lo, hi}})
+}
+
+func (d fdDomain) remove(x int) fdDomain {
+	var result fdDomain
+	for _, in := range d {
+		if x < in.lo || x > in.hi {
+			result = append(result, in)
+			continue
+		}
+		if in.lo < x {
+			result = append(result, fdInterval{in.lo, x - 1})
+		}
+		if x < in.hi {
+			result = append(result, fdInterval{x + 1, in.hi})
+		}
+	}
+	return result
+}
+
+// --- Domain conversion ---
+
+func fdBoundTerm(x int) Term {
+	switch x {
+	case fdInf:
+		return Atom("inf")
+	case fdSup:
+		return Atom("sup")
+	default:
+		return Int(x)
+	}
+}
+
+// toTerm returns the domain as a union of intervals, like '1..3 \/ 5 \/ 7..sup'.
+func (d fdDomain) toTerm() Term {
+	var t Term
+	for _, in := range d {
+		var x Term = Struct{"..", []Term{fdBoundTerm(in.lo), fdBoundTerm(in.hi)}}
+		if in.lo == in.hi {
+			x = Int(in.lo)
+		}
+		if t == nil {
+			t = x
+		} else {
+			t = Struct{"\\/", []Term{t, x}}
+		}
+	}
+	if t == nil {
+		return Struct{"..", []Term{Int(1), Int(0)}}
+	}
+	return t
+}
+
+// toList returns the domain as a list of 'Lo..Hi' intervals, to be stored in an attribute.
+func (d fdDomain) toList() Term {
+	items := make([]Term, len(d))
+	for i, in := range d {
+		items[i] = Struct{"..", []Term{fdBoundTerm(in.lo), fdBoundTerm(in.hi)}}
+	}
+	return FromList(items)
+}
+
+// parseFdAttr parses the value of a 'clpfd' attribute into its domain and propagators.
+// Values that were not stored by this library, like 'put_attr(X, clpfd, foo)', raise a type
+// error.
+func parseFdAttr(value Term, ctx Indicator) (fdDomain, []Struct, error) {
+	value = Deref(value)
+	err := typeError("clpfd_attribute", value, ctx)
+	fd, ok := value.(Struct)
+	if !ok || fd.Indicator() != (Indicator{Name: "$fd", Arity: 2}) {
+		return nil, nil, err
+	}
+	items, tail := ToList(Deref(fd.Args[0]))
+	if tail != Nil {
+		return nil, nil, err
+	}
+	d := make(fdDomain, len(items))
+	for i, item := range items {
+		in, ok := Deref(item).(Struct)
+		if !ok || in.Indicator() != (Indicator{Name: "..", Arity: 2}) {
+			return nil, nil, err
+		}
+		lo, ok1 := fdAttrBound(in.Args[0], "inf", fdInf)
+		hi, ok2 := fdAttrBound(in.Args[1], "sup", fdSup)
+		if !ok1 || !ok2 {
+			return nil, nil, err
+		}
+		d[i] = fdInterval{lo, hi}
+	}
+	terms, tail := ToList(Deref(fd.Args[1]))
+	if tail != Nil {
+		return nil, nil, err
+	}
+	props := make([]Struct, len(terms))
+	for i, t := range terms {
+		prop, ok := Deref(t).(Struct)
+		if !ok || !isFdPropagator(prop) {
+			return nil, nil, err
+		}
+		props[i] = prop
+	}
+	return d, props, nil
+}
+
+// fdAttrBound parses a bound of an interval, that is either an int or the atom for infinity.
+func fdAttrBound(t Term, infName Atom, inf int) (int, bool) {
+	switch t := Deref(t).(type) {
+	case Int:
+		return int(t), true
+	case Atom:
+		return inf, t == infName
+	}
+	return 0, false
+}
+
+// isFdPropagator returns whether the term has the shape of one of the propagators.
+func isFdPropagator(prop Struct) bool {
+	switch prop.Indicator() {
+	case Indicator{Name: "$fd_lin", Arity: 4}:
+		cs, tail1 := ToList(Deref(prop.Args[0]))
+		xs, tail2 := ToList(Deref(prop.Args[1]))
+		if tail1 != Nil || tail2 != Nil || len(cs) != len(xs) {
+			return false
+		}
+		for _, ci := range cs {
+			if _, ok := Deref(ci).(Int); !ok {
+				return false
+			}
+		}
+		op, ok := Deref(prop.Args[2]).(Atom)
+		if !ok || (op != "=" && op != "=<" && op != "\\=") {
+			return false
+		}
+		_, ok = Deref(prop.Args[3]).(Int)
+		return ok
+	case Indicator{Name: "$fd_times", Arity: 3}:
+		return true
+	case Indicator{Name: "$fd_alldiff", Arity: 1}:
+		_, tail := ToList(Deref(prop.Args[0]))
+		return tail == Nil
+	}
+	return false
+}
+
+// fdPropList returns the propagators as a list, to be stored in an attribute.
+func fdPropList(props []Struct) Term {
+	terms := make([]Term, len(props))
+	for i, prop := range props {
+		terms[i] = prop
+	}
+	return FromList(terms)
+}
+
+// parseDomain parses a domain as accepted by in/2.
+func parseDomain(t Term, ctx Indicator) (fdDomain, error) {
+	t = Deref(t)
+	switch t := t.(type) {
+	case *Ref:
+		return nil, instantiationError(ctx)
+	case Int:
+		return fdDomain{{int(t), int(t)}}, nil
+	case Struct:
+		switch t.Indicator() {
+		case Indicator{Name: "..", Arity: 2}:
+			lo, err := parseBound(t.Args[0], ctx)
+			if err != nil {
+				return nil, err
+			}
+			hi, err := parseBound(t.Args[1], ctx)
+			if err != nil {
+				return nil, err
+			}
+			return fdFull.restrict(lo, hi), nil
+		case Indicator{Name: "\\/", Arity: 2}:
+			d1, err := parseDomain(t.Args[0], ctx)
+			if err != nil {
+				return nil, err
+			}
+			d2, err := parseDomain(t.Args[1], ctx)
+			if err != nil {
+				return nil, err
+			}
+			return d1.union(d2), nil
+		}
+	}
+	return nil, typeError("clpfd_domain", t, ctx)
+}
+
+func parseBound(t Term, ctx Indicator) (int, error) {
+	switch t := Deref(t).(type) {
+	case *Ref:
+		return 0, instantiationError(ctx)
+	case Int:
+		return int(t), nil
+	case Atom:
+		switch t {
+		case "inf":
+			return fdInf, nil
+		case "sup":
+			return fdSup, nil
+		}
+	}
+	return 0, typeError("integer", t, ctx)
+}
+
+// --- Overflow-checked arithmetic ---
+
+func addOK(a, b int) (int, bool) {
+	c := a + b
+	return c, (b >= 0) == (c >= a)
+}
+
+func subOK(a, b int) (int, bool) {
+	if b == math.MinInt {
+		return 0, false
+	}
+	return addOK(a, -b)
+}
+
+func mulOK(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	return c, c/b == a && !(a == -1 && b == math.MinInt) && !(b == -1 && a == math.MinInt)
+}
+
+func fdFloorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func fdCeilDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) == (b < 0)) {
+		q++
+	}
+	return q
+}
+
+// --- Store ---
+
+// fdStore accesses and narrows the domains of refs, propagating constraints until a fixpoint.
+type fdStore struct {
+	s     Solver
+	ctx   Indicator
+	queue []Struct
+}
+
+func newFdStore(s Solver, ctx Indicator) *fdStore {
+	return &fdStore{s: s, ctx: ctx}
+}
+
+// attr returns the domain and propagators of the term.
+func (st *fdStore) attr(t Term) (fdDomain, []Struct, error) {
+	switch t := Deref(t).(type) {
+	case Int:
+		return fdDomain{{int(t), int(t)}}, nil, nil
+	case *Ref:
+		value, ok := getAttr(t, "clpfd")
+		if !ok {
+			return fdFull, nil, nil
+		}
+		return parseFdAttr(value, st.ctx)
+	case BigInt:
+		return nil, nil, representationError("max_integer", st.ctx)
+	default:
+		return nil, nil, typeError("integer", t, st.ctx)
+	}
+}
+
+func (st *fdStore) dom(t Term) (fdDomain, error) {
+	d, _, err := st.attr(t)
+	return d, err
+}
+
+// setDomain narrows the domain of the term, returning false if it becomes empty. If it
+// changes, the term's propagators are scheduled to execute.
+func (st *fdStore) setDomain(t Term, d fdDomain) (bool, error) {
+	old, props, err := st.attr(t)
+	if err != nil {
+		return false, err
+	}
+	d = d.intersect(old)
+	if d.isEmpty() {
+		return false, nil
+	}
+	if slices.Equal(d, old) {
+		return true, nil
+	}
+	ref := Deref(t).(*Ref)
+	if d.isSingleton() {
+		// Propagators are also executed by the hook, after binding.
+		return st.s.Unify(ref, Int(d.min())), nil
+	}
+	st.s.PutAttr(ref, "clpfd", Struct{"$fd", []Term{d.toList(), fdPropList(props)}})
+	st.queue = append(st.queue, props...)
+	return true, nil
+}
+
+// attach adds the propagator to the ref's list.
+func (st *fdStore) attach(ref *Ref, prop Struct) error {
+	d, props, err := st.attr(ref)
+	if err != nil {
+		return err
+	}
+	st.s.PutAttr(ref, "clpfd", Struct{"$fd", []Term{d.toList(), fdPropList(append(props, prop))}})
+	return nil
+}
+
+// post attaches a new propagator to all its refs and propagates constraints.
+func (st *fdStore) post(prop Struct) (bool, error) {
+	for _, ref := range termVariables(prop) {
+		if err := st.attach(ref, prop); err != nil {
+			return false, err
+		}
+	}
+	st.queue = append(st.queue, prop)
+	return st.run()
+}
+
+// run executes scheduled propagators until no domain changes. If that takes more than
+// fdMaxSteps, the domains would be left partially propagated, so an error is returned.
+func (st *fdStore) run() (bool, error) {
+	for steps := 0; len(st.queue) > 0; steps++ {
+		if steps == fdMaxSteps {
+			st.queue = nil
+			return false, resourceError("clpfd_propagation", st.ctx)
+		}
+		prop := st.queue[0]
+		st.queue = st.queue[1:]
+		ok, err := st.propagate(prop)
+		if !ok || err != nil {
+			return false, err
+		}
+	}
+	st.queue = nil
+	return true, nil
+}
+
+func (st *fdStore) propagate(prop Struct) (bool, error) {
+	switch prop.Name {
+	case "$fd_lin":
+		cs, _ := ToList(Deref(prop.Args[0]))
+		xs, _ := ToList(Deref(prop.Args[1]))
+		op := Deref(prop.Args[2]).(Atom)
+		c := int(Deref(prop.Args[3]).(Int))
+		coeffs := make([]int, len(cs))
+		for i, ci := range cs {
+			coeffs[i] = int(Deref(ci).(Int))
+		}
+		switch op {
+		case "=<":
+			return st.propagateLE(coeffs, xs, c)
+		case "=":
+			if ok, err := st.propagateLE(coeffs, xs, c); !ok || err != nil {
+				return ok, err
+			}
+			neg := make([]int, len(coeffs))
+			for i, ci := range coeffs {
+				neg[i] = -ci
+			}
+			return st.propagateLE(neg, xs, -c)
+		default:
+			return st.propagateNE(coeffs, xs, c)
+		}
+	case "$fd_times":
+		return st.propagateTimes(prop.Args[0], prop.Args[1], prop.Args[2])
+	case "$fd_alldiff":
+		xs, _ := ToList(Deref(prop.Args[0]))
+		return st.propagateAllDiff(xs)
+	default:
+		panic(fmt.Sprintf("unhandled propagator %v", prop))
+	}
+}
+
+// propagateLE narrows the bounds of each xi in 'sum(cs[i]*xs[i]) =< c'.
+func (st *fdStore) propagateLE(cs []int, xs []Term, c int) (bool, error) {
+	doms := make([]fdDomain, len(xs))
+	mins := make([]int, len(xs))
+	isInf := make([]bool, len(xs))
+	var sumMin, numInf int
+	for i, x := range xs {
+		d, err := st.dom(x)
+		if err != nil {
+			return false, err
+		}
+		doms[i] = d
+		bound := d.min()
+		if cs[i] < 0 {
+			bound = d.max()
+		}
+		var ok bool
+		if bound == fdInf || bound == fdSup {
+			isInf[i] = true
+			numInf++
+			continue
+		}
+		if mins[i], ok = mulOK(cs[i], bound); !ok {
+			return true, nil
+		}
+		if sumMin, ok = addOK(sumMin, mins[i]); !ok {
+			return true, nil
+		}
+	}
+	if numInf == 0 && sumMin > c {
+		return false, nil
+	}
+	for i, x := range xs {
+		rest := sumMin
+		if isInf[i] {
+			if numInf > 1 {
+				continue
+			}
+		} else {
+			if numInf > 0 {
+				continue
+			}
+			rest -= mins[i]
+		}
+		bound, ok := subOK(c, rest)
+		if !ok {
+			continue
+		}
+		var d fdDomain
+		if cs[i] > 0 {
+			d = doms[i].restrict(fdInf, fdFloorDiv(bound, cs[i]))
+		} else {
+			d = doms[i].restrict(fdCeilDiv(bound, cs[i]), fdSup)
+		}
+		if ok, err := st.setDomain(x, d); !ok || err != nil {
+			return ok, err
+		}
+	}
+	return true, nil
+}
+
+// propagateNE removes the forbidden value from the last unbound xi in 'sum(cs[i]*xs[i]) =\= c'.
+func (st *fdStore) propagateNE(cs []int, xs []Term, c int) (bool, error) {
+	free := -1
+	sum := 0
+	for i, x := range xs {
+		v, ok := Deref(x).(Int)
+		if !ok {
+			if free >= 0 {
+				return true, nil
+			}
+			free = i
+			continue
+		}
+		term, ok1 := mulOK(cs[i], int(v))
+		total, ok2 := addOK(sum, term)
+		if !ok1 || !ok2 {
+			return true, nil
+		}
+		sum = total
+	}
+	if free < 0 {
+		return sum != c, nil
+	}
+	rest, ok := subOK(c, sum)
+	if !ok || rest%cs[free] != 0 {
+		return true, nil
+	}
+	d, err := st.dom(xs[free])
+	if err != nil {
+		return false, err
+	}
+	return st.setDomain(xs[free], d.remove(rest/cs[free]))
+}
+
+// propagateTimes narrows the bounds of 'X*Y = Z'.
+func (st *fdStore) propagateTimes(x, y, z Term) (bool, error) {
+	dx, err := st.dom(x)
+	if err != nil {
+		return false, err
+	}
+	dy, err := st.dom(y)
+	if err != nil {
+		return false, err
+	}
+	dz, err := st.dom(z)
+	if err != nil {
+		return false, err
+	}
+	// Bounds of Z from the corners of X and Y.
+	if dx.isFinite() && dy.isFinite() {
+		lo, hi := fdSup, fdInf
+		for _, a := range []int{dx.min(), dx.max()} {
+			for _, b := range []int{dy.min(), dy.max()} {
+				p, ok := mulOK(a, b)
+				if !ok {
+					return true, nil
+				}
+				lo, hi = min(lo, p), max(hi, p)
+			}
+		}
+		if ok, err := st.setDomain(z, dz.restrict(lo, hi)); !ok || err != nil {
+			return ok, err
+		}
+		if dz, err = st.dom(z); err != nil {
+			return false, err
+		}
+	}
+	// Bounds of a factor when the other is fixed.
+	divide := func(a Term, da, db fdDomain) (bool, error) {
+		if !db.isSingleton() || !dz.isFinite() {
+			return true, nil
+		}
+		b := db.min()
+		if b == 0 {
+			return st.setDomain(z, dz.restrict(0, 0))
+		}
+		lo, hi := fdCeilDiv(dz.min(), b), fdFloorDiv(dz.max(), b)
+		if b < 0 {
+			lo, hi = fdCeilDiv(dz.max(), b), fdFloorDiv(dz.min(), b)
+		}
+		d := da.restrict(lo, hi)
+		if dz.isSingleton() && d.isSingleton() {
+			if p, ok := mulOK(d.min(), b); ok && p != dz.min() {
+				return false, nil
+			}
+		}
+		return st.setDomain(a, d)
+	}
+	if ok, err := divide(x, dx, dy); !ok || err != nil {
+		return ok, err
+	}
+	return divide(y, dy, dx)
+}
+
+// propagateAllDiff removes the values of bound terms from the domains of the others.
+func (st *fdStore) propagateAllDiff(xs []Term) (bool, error) {
+	seen := make(map[Int]bool)
+	var free []Term
+	for _, x := range xs {
+		v, ok := Deref(x).(Int)
+		if !ok {
+			free = append(free, x)
+			continue
+		}
+		if seen[v] {
+			return false, nil
+		}
+		seen[v] = true
+	}
+	for _, x := range free {
+		d, err := st.dom(x)
+		if err != nil {
+			return false, err
+		}
+		for v := range seen {
+			d = d.remove(int(v))
+		}
+		if ok, err := st.setDomain(x, d); !ok || err != nil {
+			return ok, err
+		}
+	}
+	return true, nil
+}
+
+// --- Expressions ---
+
+// fdLinear is a linear expression 'sum(cs[i]*xs[i]) + c'.
+type fdLinear struct {
+	cs []int
+	xs []Term
+	c  int
+}
+
+func (e *fdLinear) add(other fdLinear, k int) bool {
+	for i, x := range other.xs {
+		ck, ok := mulOK(other.cs[i], k)
+		if !ok {
+			return false
+		}
+		j := slices.IndexFunc(e.xs, func(y Term) bool { return y == x })
+		if j < 0 {
+			e.xs = append(e.xs, x)
+			e.cs = append(e.cs, ck)
+			continue
+		}
+		if e.cs[j], ok = addOK(e.cs[j], ck); !ok {
+			return false
+		}
+	}
+	ck, ok1 := mulOK(other.c, k)
+	c, ok2 := addOK(e.c, ck)
+	e.c = c
+	return ok1 && ok2
+}
+
+// linearize converts an arithmetic expression into a linear expression. Products of
+// non-constant expressions are replaced by new refs constrained with '$fd_times'.
+func (st *fdStore) linearize(t Term) (fdLinear, bool, error) {
+	t = Deref(t)
+	switch t := t.(type) {
+	case *Ref:
+		return fdLinear{cs: []int{1}, xs: []Term{t}}, true, nil
+	case Int:
+		return fdLinear{c: int(t)}, true, nil
+	case BigInt:
+		return fdLinear{}, false, representationError("max_integer", st.ctx)
+	case Float:
+		return fdLinear{}, false, typeError("integer", t, st.ctx)
+	case Struct:
+		if len(termVariables(t)) == 0 {
+			// Ground expressions are evaluated as with is/2.
+			x, err := eval(t, st.ctx)
+			if err != nil {
+				return fdLinear{}, false, err
+			}
+			if _, ok := x.(Struct); ok {
+				return fdLinear{}, false, typeError("integer", x, st.ctx)
+			}
+			return st.linearize(x)
+		}
+		var args []fdLinear
+		for _, arg := range t.Args {
+			e, ok, err := st.linearize(arg)
+			if !ok || err != nil {
+				return e, ok, err
+			}
+			args = append(args, e)
+		}
+		var e fdLinear
+		var ok bool
+		switch t.Indicator() {
+		case Indicator{Name: "+", Arity: 2}:
+			ok = e.add(args[0], 1) && e.add(args[1], 1)
+		case Indicator{Name: "-", Arity: 2}:
+			ok = e.add(args[0], 1) && e.add(args[1], -1)
+		case Indicator{Name: "-", Arity: 1}:
+			ok = e.add(args[0], -1)
+		case Indicator{Name: "+", Arity: 1}:
+			return args[0], true, nil
+		case Indicator{Name: "*", Arity: 2}:
+			switch {
+			case len(args[0].xs) == 0:
+				ok = e.add(args[1], args[0].c)
+			case len(args[1].xs) == 0:
+				ok = e.add(args[0], args[1].c)
+			default:
+				x, ok, err := st.toTerm(args[0])
+				if !ok || err != nil {
+					return e, ok, err
+				}
+				y, ok, err := st.toTerm(args[1])
+				if !ok || err != nil {
+					return e, ok, err
+				}
+				z := st.s.NewRef("_")
+				ok, err = st.post(Struct{"$fd_times", []Term{x, y, z}})
+				return fdLinear{cs: []int{1}, xs: []Term{z}}, ok, err
+			}
+		default:
+			return fdLinear{}, false, domainError("clpfd_expression", t, st.ctx)
+		}
+		if !ok {
+			return fdLinear{}, false, representationError("max_integer", st.ctx)
+		}
+		return e, true, nil
+	}
+	return fdLinear{}, false, domainError("clpfd_expression", t, st.ctx)
+}
+
+// toTerm returns a ref or int equal to the linear expression, creating a new ref if needed.
+func (st *fdStore) toTerm(e fdLinear) (Term, bool, error) {
+	if len(e.xs) == 0 {
+		return Int(e.c), true, nil
+	}
+	if len(e.xs) == 1 && e.cs[0] == 1 && e.c == 0 {
+		return e.xs[0], true, nil
+	}
+	z := st.s.NewRef("_")
+	var eq fdLinear
+	if !eq.add(e, 1) || !eq.add(fdLinear{cs: []int{1}, xs: []Term{z}}, -1) {
+		return nil, false, representationError("max_integer", st.ctx)
+	}
+	ok, err := st.postLinear(eq, "=")
+	return z, ok, err
+}
+
+// postLinear posts the constraint 'e Op 0'.
+func (st *fdStore) postLinear(e fdLinear, op Atom) (bool, error) {
+	cs := make([]Term, 0, len(e.cs))
+	xs := make([]Term, 0, len(e.xs))
+	for i, ci := range e.cs {
+		if ci != 0 {
+			cs = append(cs, Int(ci))
+			xs = append(xs, e.xs[i])
+		}
+	}
+	if e.c == math.MinInt {
+		return false, representationError("max_integer", st.ctx)
+	}
+	return st.post(Struct{"$fd_lin", []Term{FromList(cs), FromList(xs), op, Int(-e.c)}})
+}
+
+// --- Builtins ---
+
+// fdCompareBuiltin creates a builtin that posts the constraint 'L - R Op K'.
+func fdCompareBuiltin(op Atom, k int) func(Solver, Goal) ([]Goal, bool, error) {
+	return func(s Solver, goal Goal) ([]Goal, bool, error) {
+		st := newFdStore(s, goal.Term.Indicator())
+		var e fdLinear
+		for i, sign := range []int{1, -1} {
+			arg, ok, err := st.linearize(goal.Term.Args[i])
+			if !ok || err != nil {
+				return nil, ok, err
+			}
+			if !e.add(arg, sign) {
+				return isError(representationError("max_integer", st.ctx))
+			}
+		}
+		e.c -= k
+		ok, err := st.postLinear(e, op)
+		return nil, ok, err
+	}
+}
+
+var (
+	fdEqBuiltin  = fdCompareBuiltin("=", 0)
+	fdNeqBuiltin = fdCompareBuiltin("\\=", 0)
+	fdLtBuiltin  = fdCompareBuiltin("=<", -1)
+	fdLteBuiltin = fdCompareBuiltin("=<", 0)
+)
+
+// fdGtBuiltin and fdGteBuiltin swap the arguments of the less-than builtins.
+func fdGtBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return fdLtBuiltin(s, Goal{Term: Struct{"#>", []Term{goal.Term.Args[1], goal.Term.Args[0]}}})
+}
+
+func fdGteBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return fdLteBuiltin(s, Goal{Term: Struct{"#>=", []Term{goal.Term.Args[1], goal.Term.Args[0]}}})
+}
+
+// restrictAll narrows the domain of all terms to d.
+func restrictAll(s Solver, xs []Term, d fdDomain, ctx Indicator) ([]Goal, bool, error) {
+	st := newFdStore(s, ctx)
+	for _, x := range xs {
+		if _, err := st.dom(x); err != nil {
+			return isError(typeOrInstantiationError("integer", Deref(x), ctx))
+		}
+		if ok, err := st.setDomain(x, d); !ok || err != nil {
+			return nil, ok, err
+		}
+	}
+	ok, err := st.run()
+	return nil, ok, err
+}
+
+func inBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	d, err := parseDomain(goal.Term.Args[1], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	return restrictAll(s, goal.Term.Args[:1], d, goal.Term.Indicator())
+}
+
+func insBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	xs, err := toProperList(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	d, err := parseDomain(goal.Term.Args[1], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	return restrictAll(s, xs, d, goal.Term.Indicator())
+}
+
+func allDifferentBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	xs, err := toProperList(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	st := newFdStore(s, goal.Term.Indicator())
+	for _, x := range xs {
+		if _, err := st.dom(x); err != nil {
+			return isError(err)
+		}
+	}
+	ok, err := st.post(Struct{"$fd_alldiff", []Term{FromList(xs)}})
+	return nil, ok, err
+}
+
+var fdOperators = map[Atom]func(Solver, Goal) ([]Goal, bool, error){
+	"#=":   fdEqBuiltin,
+	"#\\=": fdNeqBuiltin,
+	"#<":   fdLtBuiltin,
+	"#=<":  fdLteBuiltin,
+	"#>":   fdGtBuiltin,
+	"#>=":  fdGteBuiltin,
+}
+
+// sumBuiltin posts the constraint 'sum(Vars) Op Expr'.
+func sumBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	xs, err := toProperList(goal.Term.Args[0], ctx)
+	if err != nil {
+		return isError(err)
+	}
+	op, ok := Deref(goal.Term.Args[1]).(Atom)
+	builtin, ok2 := fdOperators[op]
+	if !ok || !ok2 {
+		return isError(domainError("clpfd_operator", goal.Term.Args[1], ctx))
+	}
+	var sum Term = Int(0)
+	for i, x := range xs {
+		if i == 0 {
+			sum = x
+		} else {
+			sum = Struct{"+", []Term{sum, x}}
+		}
+	}
+	return builtin(s, Goal{Term: Struct{op, []Term{sum, goal.Term.Args[2]}}})
+}
+
+// clpfdHookBuiltin is called when a constrained ref is bound. If bound to an int, it
+// checks its domain and propagates the constraints. If bound to another ref, its domain
+// and constraints are merged into the other's.
+func clpfdHookBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	st := newFdStore(s, Indicator{Name: "clpfd", Arity: 0})
+	d, props, err := parseFdAttr(goal.Term.Args[0], st.ctx)
+	if err != nil {
+		return isError(err)
+	}
+	other := Deref(goal.Term.Args[1])
+	switch other := other.(type) {
+	case Int:
+		if !d.contains(int(other)) {
+			return isSuccess(false)
+		}
+	case *Ref:
+		d2, props2, err := st.attr(other)
+		if err != nil {
+			return isError(err)
+		}
+		d = d.intersect(d2)
+		if d.isEmpty() {
+			return isSuccess(false)
+		}
+		s.PutAttr(other, "clpfd", Struct{"$fd", []Term{d.toList(), fdPropList(slices.Concat(props2, props))}})
+	default:
+		return isError(typeError("integer", other, Indicator{Name: "=", Arity: 2}))
+	}
+	st.queue = append(st.queue, props...)
+	ok, err := st.run()
+	return nil, ok, err
+}
+
+// --- Labeling ---
+
+func labelBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	return labelingBuiltin(s, Goal{Term: Struct{"labeling", []Term{Nil, goal.Term.Args[0]}}})
+}
+
+// labelingBuiltin assigns values to all refs, in increasing order. The next ref is chosen
+// with the 'leftmost' (default) or 'ff' (first-fail, smallest domain) strategy.
+func labelingBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	opts, err := toProperList(goal.Term.Args[0], ctx)
+	if err != nil {
+		return isError(err)
+	}
+	strategy := Atom("leftmost")
+	for _, opt := range opts {
+		opt = Deref(opt)
+		if opt != Atom("leftmost") && opt != Atom("ff") {
+			return isError(domainError("labeling_option", opt, ctx))
+		}
+		strategy = opt.(Atom)
+	}
+	xs, err := toProperList(goal.Term.Args[1], ctx)
+	if err != nil {
+		return isError(err)
+	}
+	st := newFdStore(s, ctx)
+	for _, x := range xs {
+		d, err := st.dom(x)
+		if err != nil {
+			return isError(typeOrInstantiationError("integer", Deref(x), ctx))
+		}
+		if !d.isFinite() {
+			return isError(instantiationError(ctx))
+		}
+	}
+	return hasContinuation([]Goal{{Term: Struct{"$label", []Term{strategy, FromList(xs)}}}})
+}
+
+// labelStepBuiltin chooses a ref and branches on assigning its smallest value, or excluding it.
+func labelStepBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	strategy := goal.Term.Args[0].(Atom)
+	xs, _ := ToList(Deref(goal.Term.Args[1]))
+	st := newFdStore(s, goal.Term.Indicator())
+	var x Term
+	var dx fdDomain
+	for _, y := range xs {
+		if _, ok := Deref(y).(*Ref); !ok {
+			continue
+		}
+		d, err := st.dom(y)
+		if err != nil {
+			return isError(err)
+		}
+		if x == nil || (strategy == "ff" && d.size() < dx.size()) {
+			x, dx = y, d
+		}
+		if strategy == "leftmost" {
+			break
+		}
+	}
+	if x == nil {
+		return isSuccess(true)
+	}
+	v := Int(dx.min())
+	return hasContinuation([]Goal{{Term: Struct{";", []Term{
+		Struct{",", []Term{Struct{"=", []Term{x, v}}, goal.Term}},
+		Struct{",", []Term{Struct{"#\\=", []Term{x, v}}, goal.Term}},
+	}}}})
+}
+
+// --- Reflection ---
+
+func fdDomBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	st := newFdStore(s, goal.Term.Indicator())
+	d, err := st.dom(goal.Term.Args[0])
+	if err != nil {
+		return isError(err)
+	}
+	return isSuccess(s.Unify(d.toTerm(), goal.Term.Args[1]))
+}
+
+func fdInfBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	st := newFdStore(s, goal.Term.Indicator())
+	d, err := st.dom(goal.Term.Args[0])
+	if err != nil {
+		return isError(err)
+	}
+	return isSuccess(s.Unify(fdBoundTerm(d.min()), goal.Term.Args[1]))
+}
+
+func fdSupBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	st := newFdStore(s, goal.Term.Indicator())
+	d, err := st.dom(goal.Term.Args[0])
+	if err != nil {
+		return isError(err)
+	}
+	return isSuccess(s.Unify(fdBoundTerm(d.max()), goal.Term.Args[1]))
+}
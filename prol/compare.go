@@ -0,0 +1,191 @@
+package prol
+
+import (
+	"cmp"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// --- Standard order of terms ---
+
+func typeRank(t Term) int {
+	switch t.(type) {
+	case Var, *Ref:
+		return 0
+	case Int, BigInt, Float:
+		return 1
+	case Atom:
+		return 2
+	case Struct:
+		return 3
+	default:
+		panic(fmt.Sprintf("unhandled term type %T", t))
+	}
+}
+
+// Compare compares two terms in the standard order: Var < Number < Atom < Struct, returning
+// -1, 0 or +1 if t1 is respectively less than, equal to or greater than t2.
+//
+// Refs are ordered by the solver that created them, then by creation, numbers by value (with floats before ints of equal value)
+// and atoms alphabetically. Structs are ordered by arity, then name, and then by each arg
+// from left to right.
+func Compare(t1, t2 Term) int {
+	t1, t2 = Deref(t1), Deref(t2)
+	if r1, r2 := typeRank(t1), typeRank(t2); r1 != r2 {
+		return cmp.Compare(r1, r2)
+	}
+	switch t1 := t1.(type) {
+	case Var:
+		if t2, ok := t2.(Var); ok {
+			return strings.Compare(string(t1), string(t2))
+		}
+		return -1
+	case *Ref:
+		if t2, ok := t2.(*Ref); ok {
+			if c := cmp.Compare(t1.src, t2.src); c != 0 {
+				return c
+			}
+			return cmp.Compare(t1.id, t2.id)
+		}
+		return +1
+	case Int, BigInt, Float:
+		if c := compareNumbers(t1, t2); c != 0 {
+			return c
+		}
+		_, isFloat1 := t1.(Float)
+		_, isFloat2 := t2.(Float)
+		switch {
+		case isFloat1 && !isFloat2:
+			return -1
+		case !isFloat1 && isFloat2:
+			return +1
+		default:
+			return 0
+		}
+	case Atom:
+		return strings.Compare(string(t1), string(t2.(Atom)))
+	case Struct:
+		s2 := t2.(Struct)
+		if c := cmp.Compare(len(t1.Args), len(s2.Args)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(string(t1.Name), string(s2.Name)); c != 0 {
+			return c
+		}
+		for i := range t1.Args {
+			if c := Compare(t1.Args[i], s2.Args[i]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	default:
+		panic(fmt.Sprintf("unhandled term type %T", t1))
+	}
+}
+
+// compareInts compares two integers, either Int or BigInt, by value.
+func compareInts(t1, t2 Term) int {
+	i1, ok1 := t1.(Int)
+	i2, ok2 := t2.(Int)
+	if ok1 && ok2 {
+		return cmp.Compare(i1, i2)
+	}
+	return toBig(t1).Cmp(toBig(t2))
+}
+
+// compareNumbers compares two numbers by value.
+//
+// Comparisons between ints and floats are exact, without rounding the int to a float.
+func compareNumbers(t1, t2 Term) int {
+	f1, ok1 := t1.(Float)
+	f2, ok2 := t2.(Float)
+	switch {
+	case ok1 && ok2:
+		return cmp.Compare(f1, f2)
+	case ok1:
+		return new(big.Float).SetFloat64(float64(f1)).Cmp(new(big.Float).SetInt(toBig(t2)))
+	case ok2:
+		return new(big.Float).SetInt(toBig(t1)).Cmp(new(big.Float).SetFloat64(float64(f2)))
+	default:
+		return compareInts(t1, t2)
+	}
+}
+
+// isIdentical returns whether both terms are structurally identical, without binding refs.
+//
+// Cyclic terms are compared coinductively: a pair of bound refs already being compared is
+// assumed to be identical.
+func isIdentical(t1, t2 Term) bool {
+	return identical(t1, t2, make(map[[2]*Ref]bool))
+}
+
+func identical(t1, t2 Term, visiting map[[2]*Ref]bool) bool {
+	r1, ok1 := t1.(*Ref)
+	r2, ok2 := t2.(*Ref)
+	if ok1 && ok2 && r1.Value != nil && r2.Value != nil {
+		pair := [2]*Ref{r1, r2}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+		return identical(r1.Value, r2.Value, visiting)
+	}
+	if ok1 && r1.Value != nil {
+		return identical(r1.Value, t2, visiting)
+	}
+	if ok2 && r2.Value != nil {
+		return identical(t1, r2.Value, visiting)
+	}
+	s1, ok1 := t1.(Struct)
+	s2, ok2 := t2.(Struct)
+	if !ok1 || !ok2 {
+		return t1 == t2
+	}
+	if s1.Name != s2.Name || len(s1.Args) != len(s2.Args) {
+		return false
+	}
+	for i := range s1.Args {
+		if !identical(s1.Args[i], s2.Args[i], visiting) {
+			return false
+		}
+	}
+	return true
+}
+
+// isVariant returns whether both terms are equal up to a consistent renaming of refs.
+func isVariant(t1, t2 Term) bool {
+	return variant(t1, t2, make(map[*Ref]*Ref), make(map[*Ref]*Ref))
+}
+
+func variant(t1, t2 Term, m12, m21 map[*Ref]*Ref) bool {
+	t1, t2 = Deref(t1), Deref(t2)
+	switch t1 := t1.(type) {
+	case *Ref:
+		r2, ok := t2.(*Ref)
+		if !ok {
+			return false
+		}
+		x2, ok1 := m12[t1]
+		x1, ok2 := m21[r2]
+		if !ok1 && !ok2 {
+			m12[t1], m21[r2] = r2, t1
+			return true
+		}
+		return x2 == r2 && x1 == t1
+	case Struct:
+		s2, ok := t2.(Struct)
+		if !ok || t1.Name != s2.Name || len(t1.Args) != len(s2.Args) {
+			return false
+		}
+		for i := range t1.Args {
+			if !variant(t1.Args[i], s2.Args[i], m12, m21) {
+				return false
+			}
+		}
+		return true
+	default:
+		return t1 == t2
+	}
+}
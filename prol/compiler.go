@@ -10,9 +10,9 @@ func CompileRule(ast Term) (Rule, error) {
 		return nil, fmt.Errorf("CompileRule: %w", err)
 	}
 	switch ruleAST.Indicator() {
-	case Indicator{"clause", 2}:
+	case Indicator{Name: "clause", Arity: 2}:
 		return compileClause(ruleAST)
-	case Indicator{"dcg", 2}:
+	case Indicator{Name: "dcg", Arity: 2}:
 		return compileDCG(ruleAST)
 	default:
 		return nil, fmt.Errorf("CompileRule: unimplemented rule type: %v", ruleAST.Indicator())
@@ -24,7 +24,7 @@ func CompileIndicator(ast Term) (Indicator, error) {
 	if err != nil {
 		return Indicator{}, fmt.Errorf("CompileIndicator: %w", err)
 	}
-	if err := checkIndicator(indAST, Indicator{"indicator", 2}); err != nil {
+	if err := checkIndicator(indAST, Indicator{Name: "indicator", Arity: 2}); err != nil {
 		return Indicator{}, fmt.Errorf("CompileIndicator: %w", err)
 	}
 	nameAST, arityAST := Deref(indAST.Args[0]), Deref(indAST.Args[1])
@@ -36,7 +36,7 @@ func CompileIndicator(ast Term) (Indicator, error) {
 	if err != nil {
 		return Indicator{}, fmt.Errorf("CompileIndicator: arg #2: %w", err)
 	}
-	return Indicator{name, int(arity)}, nil
+	return Indicator{Name: name, Arity: int(arity)}, nil
 }
 
 func compileDCG(ast Struct) (Rule, error) {
@@ -93,13 +93,15 @@ func compileClause(ast Struct) (Rule, error) {
 
 func compileTerm(ast Struct) (Term, error) {
 	switch ast.Indicator() {
-	case Indicator{"atom", 1}:
+	case Indicator{Name: "atom", Arity: 1}:
 		return compileAtom(ast)
-	case Indicator{"int", 1}:
+	case Indicator{Name: "int", Arity: 1}:
 		return compileInt(ast)
-	case Indicator{"var", 1}:
+	case Indicator{Name: "float", Arity: 1}:
+		return compileFloat(ast)
+	case Indicator{Name: "var", Arity: 1}:
 		return compileVar(ast)
-	case Indicator{"struct", 2}:
+	case Indicator{Name: "struct", Arity: 2}:
 		return compileStruct(ast)
 	default:
 		return nil, fmt.Errorf("compileTerm: unimplemented term type: %v", ast.Indicator())
@@ -107,7 +109,7 @@ func compileTerm(ast Struct) (Term, error) {
 }
 
 func compileAtom(ast Struct) (Atom, error) {
-	if err := checkIndicator(ast, Indicator{"atom", 1}); err != nil {
+	if err := checkIndicator(ast, Indicator{Name: "atom", Arity: 1}); err != nil {
 		return Atom(""), err
 	}
 	arg1 := Deref(ast.Args[0])
@@ -118,20 +120,35 @@ func compileAtom(ast Struct) (Atom, error) {
 	return name, nil
 }
 
-func compileInt(ast Struct) (Int, error) {
-	if err := checkIndicator(ast, Indicator{"int", 1}); err != nil {
-		return Int(0), err
+func compileInt(ast Struct) (Term, error) {
+	if err := checkIndicator(ast, Indicator{Name: "int", Arity: 1}); err != nil {
+		return nil, err
 	}
 	arg1 := Deref(ast.Args[0])
+	if i, ok := arg1.(BigInt); ok {
+		return i, nil
+	}
 	i, err := checkInt(arg1)
 	if err != nil {
-		return Int(0), fmt.Errorf("name: %w", err)
+		return nil, fmt.Errorf("name: %w", err)
 	}
 	return i, nil
 }
 
+func compileFloat(ast Struct) (Float, error) {
+	if err := checkIndicator(ast, Indicator{Name: "float", Arity: 1}); err != nil {
+		return Float(0), err
+	}
+	arg1 := Deref(ast.Args[0])
+	f, ok := arg1.(Float)
+	if !ok {
+		return Float(0), fmt.Errorf("name: not a float")
+	}
+	return f, nil
+}
+
 func compileVar(ast Struct) (Var, error) {
-	if err := checkIndicator(ast, Indicator{"var", 1}); err != nil {
+	if err := checkIndicator(ast, Indicator{Name: "var", Arity: 1}); err != nil {
 		return Var(""), err
 	}
 	arg1 := Deref(ast.Args[0])
@@ -143,7 +160,7 @@ func compileVar(ast Struct) (Var, error) {
 }
 
 func compileStruct(ast Struct) (Struct, error) {
-	if err := checkIndicator(ast, Indicator{"struct", 2}); err != nil {
+	if err := checkIndicator(ast, Indicator{Name: "struct", Arity: 2}); err != nil {
 		return Struct{}, err
 	}
 	arg1, arg2 := Deref(ast.Args[0]), Deref(ast.Args[1])
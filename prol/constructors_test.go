@@ -14,6 +14,10 @@ func int_(i int) prol.Int {
 	return prol.Int(i)
 }
 
+func float_(f float64) prol.Float {
+	return prol.Float(f)
+}
+
 func v(name string) prol.Var {
 	return prol.MustVar(name)
 }
@@ -0,0 +1,407 @@
+package prol
+
+import (
+	"slices"
+)
+
+// --- Control constructs ---
+
+// controlFunc executes a control construct at depth s.depth, returning the continuation to
+// execute next, or false if it failed. Alternatives are tried by pushing choice points.
+//
+// cutBarrier is the barrier of the environment where the goal appears, and env is the
+// continuation after it.
+type controlFunc func(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error)
+
+var controlConstructs map[Indicator]controlFunc
+
+func init() {
+	controlConstructs = map[Indicator]controlFunc{
+		{Name: "!", Arity: 0}:                cutControl,
+		{Name: "$cut", Arity: 1}:             cutToControl,
+		{Name: "$soft_cut", Arity: 1}:        softCutControl,
+		{Name: "call", Arity: 1}:             callControl,
+		{Name: "call", Arity: 2}:             callControl,
+		{Name: "call", Arity: 3}:             callControl,
+		{Name: "call", Arity: 4}:             callControl,
+		{Name: "call", Arity: 5}:             callControl,
+		{Name: "call", Arity: 6}:             callControl,
+		{Name: "call", Arity: 7}:             callControl,
+		{Name: "call", Arity: 8}:             callControl,
+		{Name: "catch", Arity: 3}:            catchControl,
+		{Name: "$catch_exit", Arity: 1}:      catchExitControl,
+		{Name: "$findall_collect", Arity: 2}: findallCollectControl,
+		{Name: ",", Arity: 2}:                conjunctionControl,
+		{Name: ";", Arity: 2}:                disjunctionControl,
+		{Name: "->", Arity: 2}:               ifThenControl,
+		{Name: "*->", Arity: 2}:              softIfThenControl,
+		{Name: "\\+", Arity: 1}:              notControl,
+		{Name: "$untabled", Arity: 1}:        untabledControl,
+		{Name: "retract", Arity: 1}:          retractControl,
+		{Name: "clause", Arity: 2}:           clauseControl,
+		{Name: ":", Arity: 2}:                moduleControl,
+	}
+}
+
+// toGoal converts a term from a control construct argument into an executable goal.
+//
+// ind is the indicator of the control construct, used as error context.
+func toGoal(t Term, ind Indicator) (Goal, error) {
+	switch t := Deref(t).(type) {
+	case Struct:
+		return Goal{Term: t}, nil
+	case Atom:
+		return Goal{Term: Struct{t, nil}}, nil
+	case *Ref:
+		return Goal{}, instantiationError(ind)
+	default:
+		return Goal{}, typeError("callable", t, ind)
+	}
+}
+
+func toGoals(ind Indicator, ts ...Term) ([]Goal, error) {
+	goals := make([]Goal, len(ts))
+	for i, t := range ts {
+		var err error
+		goals[i], err = toGoal(t, ind)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return goals, nil
+}
+
+// disjunction combines the goals into nested ;/2 goals, or returns the single goal.
+func disjunction(goals []Struct) Struct {
+	goal := goals[len(goals)-1]
+	for i := len(goals) - 2; i >= 0; i-- {
+		goal = Struct{";", []Term{goals[i], goal}}
+	}
+	return goal
+}
+
+// conjunction combines the goals into nested ','/2 terms, or returns 'true' if there are none.
+func conjunction(goals []Goal) Term {
+	if len(goals) == 0 {
+		return Atom("true")
+	}
+	terms := make([]Term, len(goals))
+	for i, goal := range goals {
+		terms[i] = goal.Term
+		if len(goal.Term.Args) == 0 {
+			terms[i] = goal.Term.Name
+		}
+	}
+	t := terms[len(terms)-1]
+	for i := len(terms) - 2; i >= 0; i-- {
+		t = Struct{",", []Term{terms[i], t}}
+	}
+	return t
+}
+
+func callGoal(goal Goal) Goal {
+	return Goal{Struct{"call", []Term{goal.Term}}, goal.LexerState}
+}
+
+func cutGoal(height int) Goal {
+	return Goal{Term: Struct{"$cut", []Term{Int(height)}}}
+}
+
+func softCutGoal(height int) Goal {
+	return Goal{Term: Struct{"$soft_cut", []Term{Int(height)}}}
+}
+
+// alternatives tries each environment in turn, keeping a choice point for the remaining ones.
+//
+// A cut to the current choice stack height prevents the remaining alternatives from being tried.
+func (s *solver) alternatives(env *environment, rest ...*environment) (*environment, bool, error) {
+	if len(rest) > 0 {
+		s.pushChoice(func(cp *choicePoint) (*environment, bool, error) {
+			env := rest[0]
+			rest = rest[1:]
+			cp.done = len(rest) == 0
+			return env, true, nil
+		})
+	}
+	return env, true, nil
+}
+
+// cutControl succeeds once, and removes all choice points up to the barrier.
+func cutControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	s.cut(cutBarrier)
+	return env, true, nil
+}
+
+// cutToControl is like cutControl, but with an explicit barrier.
+func cutToControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	height := goal.Term.Args[0].(Int)
+	return cutControl(s, goal, int(height), env)
+}
+
+// softCutControl marks that the condition of a soft-cut had a solution, disabling the
+// choice point at the given height that would execute its 'Else' branch.
+func softCutControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	height := int(goal.Term.Args[0].(Int))
+	if height == len(s.choices)-1 {
+		// The condition has no more solutions, so the choice point can be removed.
+		s.cut(height)
+	} else {
+		s.choices[height].next = nil
+	}
+	return env, true, nil
+}
+
+// callControl executes the goal with the current choice stack height as barrier, so it's
+// opaque to cut.
+//
+// Extra arguments are appended to the goal's arguments, so it may be used with closures.
+func callControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	g, err := toGoal(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return nil, false, err
+	}
+	if extra := goal.Term.Args[1:]; len(extra) > 0 {
+		g.Term = addArgs(g.Term, extra)
+	}
+	return env.push([]Goal{g}, len(s.choices), s.depth), true, nil
+}
+
+// addArgs appends extra arguments to a goal, or to the inner goal of a qualified goal.
+func addArgs(g Struct, extra []Term) Struct {
+	if g.Indicator() == (Indicator{Name: ":", Arity: 2}) {
+		inner, err := toGoal(g.Args[1], g.Indicator())
+		if err == nil {
+			return Struct{":", []Term{g.Args[0], addArgs(inner.Term, extra)}}
+		}
+	}
+	return Struct{g.Name, slices.Concat(g.Args, extra)}
+}
+
+// catchFrame is the state of a catch/3 call, kept in a choice point that marks the
+// position of the call in the choice stack.
+type catchFrame struct {
+	catcher, recovery Term
+	// Continuation and cut barrier of the catch/3 call.
+	env        *environment
+	cutBarrier int
+	// Whether the goal has exited, so exceptions from the continuation aren't caught.
+	exited bool
+}
+
+// catchControl executes 'Goal' as with call/1. If an exception is raised during its
+// execution, all bindings are undone and the exception term is unified with 'Catcher', and
+// then 'Recovery' is executed in its place.
+//
+// Exceptions raised by the continuation, after 'Goal' exits, are not caught.
+func catchControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	g, catcher, recovery := goal.Term.Args[0], goal.Term.Args[1], goal.Term.Args[2]
+	height := len(s.choices)
+	cp := s.pushChoice(nil)
+	cp.catch = &catchFrame{catcher: catcher, recovery: recovery, env: env, cutBarrier: cutBarrier}
+	goals := []Goal{
+		{Term: Struct{"call", []Term{g}}},
+		{Term: Struct{"$catch_exit", []Term{Int(height)}}},
+	}
+	return env.push(goals, len(s.choices), s.depth), true, nil
+}
+
+// catchExitControl marks that the goal of the catch at the given height has exited, so
+// exceptions raised from the continuation are not caught by it.
+func catchExitControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	height := int(goal.Term.Args[0].(Int))
+	if height == len(s.choices)-1 {
+		// The goal exited deterministically, so the catch frame is no longer needed.
+		s.cut(height)
+		return env, true, nil
+	}
+	frame := s.choices[height].catch
+	frame.exited = true
+	s.pushChoice(func(cp *choicePoint) (*environment, bool, error) {
+		// Backtracking into the catch goal.
+		frame.exited = false
+		cp.done = true
+		return nil, false, nil
+	})
+	return env, true, nil
+}
+
+// findallCollectControl stores a copy of the template in the bag, and fails to get the next solution.
+func findallCollectControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	i := goal.Term.Args[0].(Int)
+	s.bags[i] = append(s.bags[i], copyTerm(goal.Term.Args[1], make(map[*Ref]*Ref), s.NewRef))
+	return nil, false, nil
+}
+
+// FindAll returns a copy of template for each solution of goal.
+//
+// The goal is executed in a nested search, and all bindings are undone when it returns.
+func (s *solver) FindAll(template, goal Term) ([]Term, error) {
+	g, err := toGoal(goal, Indicator{Name: "call", Arity: 1})
+	if err != nil {
+		return nil, err
+	}
+	// Goals woken before the call belong to the caller's continuation.
+	wakeups := s.wakeups
+	s.wakeups = nil
+	defer func() { s.wakeups = wakeups }()
+	i := len(s.bags)
+	s.bags = append(s.bags, nil)
+	defer func() { s.bags = s.bags[:i] }()
+	collect := Goal{Term: Struct{"$findall_collect", []Term{Int(i), template}}}
+	// The collector always fails, so the search never reaches the empty environment.
+	var done *environment
+	if err := s.run(done.push([]Goal{g, collect}, len(s.choices), s.depth)); err != nil {
+		return nil, err
+	}
+	return s.bags[i], nil
+}
+
+// conjunctionControl executes both goals in sequence, and is transparent to cut.
+func conjunctionControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	goals, err := toGoals(goal.Term.Indicator(), goal.Term.Args...)
+	if err != nil {
+		return nil, false, err
+	}
+	return env.push(goals, cutBarrier, s.depth), true, nil
+}
+
+// disjunctionControl tries each goal as an alternative, and is transparent to cut.
+//
+// If the left goal is an if-then or soft-cut construct, it behaves as if-then-else.
+func disjunctionControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	left, ok := Deref(goal.Term.Args[0]).(Struct)
+	if ok && left.Indicator() == (Indicator{Name: "->", Arity: 2}) {
+		return s.ifThenElse(left.Args[0], left.Args[1], goal.Term.Args[1], cutBarrier, env)
+	}
+	if ok && left.Indicator() == (Indicator{Name: "*->", Arity: 2}) {
+		return s.softIfThenElse(left.Args[0], left.Args[1], goal.Term.Args[1], cutBarrier, env)
+	}
+	goals, err := toGoals(goal.Term.Indicator(), goal.Term.Args...)
+	if err != nil {
+		return nil, false, err
+	}
+	return s.alternatives(
+		env.push(goals[:1], cutBarrier, s.depth),
+		env.push(goals[1:], cutBarrier, s.depth))
+}
+
+// ifThenControl executes 'Then' for the first solution of 'Cond', failing if there are none.
+func ifThenControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	return s.ifThenElse(goal.Term.Args[0], goal.Term.Args[1], Atom("fail"), cutBarrier, env)
+}
+
+// softIfThenControl executes 'Then' for every solution of 'Cond'.
+func softIfThenControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	return s.softIfThenElse(goal.Term.Args[0], goal.Term.Args[1], Atom("fail"), cutBarrier, env)
+}
+
+// notControl succeeds if the goal has no solutions, without binding any variables.
+func notControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	return s.ifThenElse(goal.Term.Args[0], Atom("fail"), Atom("true"), cutBarrier, env)
+}
+
+// ifThenElse commits to the first solution of 'Cond' and executes 'Then', or executes 'Else'
+// if there are none. 'Cond' is opaque to cut, while 'Then' and 'Else' are transparent.
+func (s *solver) ifThenElse(cond, then, else_ Term, cutBarrier int, env *environment) (*environment, bool, error) {
+	goals, err := toGoals(Indicator{Name: "->", Arity: 2}, cond, then, else_)
+	if err != nil {
+		return nil, false, err
+	}
+	height := len(s.choices)
+	condGoals := []Goal{callGoal(goals[0]), cutGoal(height)}
+	return s.alternatives(
+		env.push(goals[1:2], cutBarrier, s.depth).push(condGoals, height, s.depth),
+		env.push(goals[2:], cutBarrier, s.depth))
+}
+
+// softIfThenElse executes 'Then' for every solution of 'Cond', or executes 'Else' if there
+// are none. Like ifThenElse, 'Cond' is opaque to cut.
+func (s *solver) softIfThenElse(cond, then, else_ Term, cutBarrier int, env *environment) (*environment, bool, error) {
+	goals, err := toGoals(Indicator{Name: "*->", Arity: 2}, cond, then, else_)
+	if err != nil {
+		return nil, false, err
+	}
+	height := len(s.choices)
+	condGoals := []Goal{callGoal(goals[0]), softCutGoal(height)}
+	return s.alternatives(
+		env.push(goals[1:2], cutBarrier, s.depth).push(condGoals, height, s.depth),
+		env.push(goals[2:], cutBarrier, s.depth))
+}
+
+// retractControl removes the first clause that unifies with 'Head :- Body', or 'Head' for
+// facts, and the next ones on backtracking.
+//
+// The clauses are the ones present when retract is called, following the logical update
+// view. Clauses removed in the meantime are skipped.
+func retractControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	ctx := goal.Term.Indicator()
+	module, head, err := unqualify(goal.Term.Args[0], ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	body := Term(Atom("true"))
+	if t, ok := head.(Struct); ok && t.Indicator() == (Indicator{Name: ":-", Arity: 2}) {
+		head, body = t.Args[0], t.Args[1]
+	}
+	g, ind, err := toQualifiedGoal(qualify(module, head), ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.db.IsStatic(ind) {
+		return nil, false, permissionError("modify", "static_procedure", indicatorTerm(ind), ctx)
+	}
+	rules := s.db.matching(ind, g)
+	s.pushChoice(func(cp *choicePoint) (*environment, bool, error) {
+		for len(rules) > 0 {
+			s.restore(cp)
+			rule := rules[0]
+			rules = rules[1:]
+			cp.done = len(rules) == 0
+			goals, ok, err := rule.Unify(s, g)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok && s.Unify(body, conjunction(goals)) && s.db.Retract(ind, rule) {
+				return s.wake(env), true, nil
+			}
+		}
+		cp.done = true
+		return nil, false, nil
+	})
+	return nil, false, nil
+}
+
+// clauseControl enumerates the clauses whose head and body unify with the arguments, with
+// the body as a conjunction term. Each clause is renamed only when it's tried.
+func clauseControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	ctx := goal.Term.Indicator()
+	head, ind, err := toQualifiedGoal(goal.Term.Args[0], ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	body := Deref(goal.Term.Args[1])
+	switch body.(type) {
+	case *Ref, Atom, Struct:
+	default:
+		return nil, false, typeError("callable", body, ctx)
+	}
+	if s.db.IsStatic(ind) {
+		return nil, false, permissionError("access", "private_procedure", indicatorTerm(ind), ctx)
+	}
+	rules := s.db.matching(ind, head)
+	s.pushChoice(func(cp *choicePoint) (*environment, bool, error) {
+		for len(rules) > 0 {
+			s.restore(cp)
+			rule := rules[0]
+			rules = rules[1:]
+			cp.done = len(rules) == 0
+			h, b := clauseTerms(rule, s.NewRef)
+			if s.Unify(head.Term, h) && s.Unify(body, b) {
+				return s.wake(env), true, nil
+			}
+		}
+		cp.done = true
+		return nil, false, nil
+	})
+	return nil, false, nil
+}
@@ -0,0 +1,375 @@
+package prol
+
+import (
+	"slices"
+)
+
+// --- Attributed variables ---
+
+// attribute is a value attached to a ref by a module, with put_attr/3.
+type attribute struct {
+	module Atom
+	value  Term
+}
+
+// attrHooks are the unify hooks of builtin modules, implemented as builtin predicates.
+//
+// Modules not listed here have their hook called as 'Module:attr_unify_hook(Value, Other)'.
+var attrHooks = map[Atom]Atom{
+	"freeze": "$freeze_hook",
+	"dif":    "$dif_hook",
+	"when":   "$when_hook",
+	"clpfd":  "$clpfd_hook",
+}
+
+// wakeup returns the goal to be executed when the attributed ref is bound to other.
+func (attr attribute) wakeup(other Term) Goal {
+	if hook, ok := attrHooks[attr.module]; ok {
+		return Goal{Term: Struct{hook, []Term{attr.value, other}}}
+	}
+	hook := Struct{"attr_unify_hook", []Term{attr.value, other}}
+	return Goal{Term: Struct{":", []Term{attr.module, hook}}}
+}
+
+// getAttr returns the value of the module's attribute in ref.
+func getAttr(ref *Ref, module Atom) (Term, bool) {
+	i := slices.IndexFunc(ref.attrs, func(attr attribute) bool { return attr.module == module })
+	if i < 0 {
+		return nil, false
+	}
+	return ref.attrs[i].value, true
+}
+
+// PutAttr sets the value of the module's attribute in ref, restoring it on backtracking.
+func (s *solver) PutAttr(ref *Ref, module Atom, value Term) {
+	s.trail = append(s.trail, trailEntry{kind: trailAttrs, ref: ref, attrs: ref.attrs})
+	i := slices.IndexFunc(ref.attrs, func(attr attribute) bool { return attr.module == module })
+	if i < 0 {
+		ref.attrs = append(slices.Clip(ref.attrs), attribute{module, value})
+		return
+	}
+	ref.attrs = slices.Clone(ref.attrs)
+	ref.attrs[i].value = value
+}
+
+// DelAttr removes the module's attribute from ref, restoring it on backtracking.
+func (s *solver) DelAttr(ref *Ref, module Atom) {
+	i := slices.IndexFunc(ref.attrs, func(attr attribute) bool { return attr.module == module })
+	if i < 0 {
+		return
+	}
+	s.trail = append(s.trail, trailEntry{kind: trailAttrs, ref: ref, attrs: ref.attrs})
+	ref.attrs = slices.Delete(slices.Clone(ref.attrs), i, i+1)
+}
+
+// wake pushes the goals woken by the last unification onto the environment.
+func (s *solver) wake(env *environment) *environment {
+	if len(s.wakeups) == 0 {
+		return env
+	}
+	goals := s.wakeups
+	s.wakeups = nil
+	return env.push(goals, len(s.choices), s.depth)
+}
+
+// toAttrArgs validates the ref and module arguments of the attribute builtins.
+func toAttrArgs(goal Goal) (*Ref, Atom, error) {
+	ctx := goal.Term.Indicator()
+	v, module := Deref(goal.Term.Args[0]), Deref(goal.Term.Args[1])
+	ref, ok := v.(*Ref)
+	if !ok {
+		return nil, "", uninstantiationError(v, ctx)
+	}
+	atom, ok := module.(Atom)
+	if !ok {
+		return nil, "", typeOrInstantiationError("atom", module, ctx)
+	}
+	return ref, atom, nil
+}
+
+func putAttrBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ref, module, err := toAttrArgs(goal)
+	if err != nil {
+		return isError(err)
+	}
+	s.PutAttr(ref, module, goal.Term.Args[2])
+	return isSuccess(true)
+}
+
+func getAttrBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ref, ok := Deref(goal.Term.Args[0]).(*Ref)
+	if !ok {
+		return isSuccess(false)
+	}
+	module, ok := Deref(goal.Term.Args[1]).(Atom)
+	if !ok {
+		return isError(typeOrInstantiationError("atom", goal.Term.Args[1], goal.Term.Indicator()))
+	}
+	value, ok := getAttr(ref, module)
+	return isSuccess(ok && s.Unify(value, goal.Term.Args[2]))
+}
+
+func delAttrBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ref, ok := Deref(goal.Term.Args[0]).(*Ref)
+	if !ok {
+		return isSuccess(true)
+	}
+	module, ok := Deref(goal.Term.Args[1]).(Atom)
+	if !ok {
+		return isError(typeOrInstantiationError("atom", goal.Term.Args[1], goal.Term.Indicator()))
+	}
+	s.DelAttr(ref, module)
+	return isSuccess(true)
+}
+
+// appendAttr adds an item to a list attribute of the ref, unless an identical item is present.
+func appendAttr(s Solver, ref *Ref, module Atom, item Term) {
+	var items []Term
+	if value, ok := getAttr(ref, module); ok {
+		items, _ = ToList(value)
+	}
+	if slices.ContainsFunc(items, func(x Term) bool { return isIdentical(x, item) }) {
+		return
+	}
+	s.PutAttr(ref, module, FromList(append(items, item)))
+}
+
+// callGoals returns a call/1 goal for each term.
+func callGoals(terms []Term) []Goal {
+	goals := make([]Goal, len(terms))
+	for i, t := range terms {
+		goals[i] = Goal{Term: Struct{"call", []Term{t}}}
+	}
+	return goals
+}
+
+// --- freeze/2 ---
+
+// freezeBuiltin delays the execution of 'Goal' until 'Var' is bound to a non-ref term.
+func freezeBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	x, g := Deref(goal.Term.Args[0]), goal.Term.Args[1]
+	ref, ok := x.(*Ref)
+	if !ok {
+		return hasContinuation(callGoals([]Term{g}))
+	}
+	s.PutAttr(ref, "freeze", FromList(append(frozenGoals(ref), g)))
+	return isSuccess(true)
+}
+
+func frozenGoals(ref *Ref) []Term {
+	value, ok := getAttr(ref, "freeze")
+	if !ok {
+		return nil
+	}
+	goals, _ := ToList(value)
+	return goals
+}
+
+// freezeHookBuiltin executes the frozen goals when the ref is bound, or passes them along
+// to the other ref if it's bound to an unbound ref.
+func freezeHookBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	goals, _ := ToList(Deref(goal.Term.Args[0]))
+	other := Deref(goal.Term.Args[1])
+	if ref, ok := other.(*Ref); ok {
+		s.PutAttr(ref, "freeze", FromList(slices.Concat(frozenGoals(ref), goals)))
+		return isSuccess(true)
+	}
+	return hasContinuation(callGoals(goals))
+}
+
+// frozenBuiltin unifies 'Goal' with the conjunction of goals frozen on 'Var', or 'true'.
+func frozenBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	var goals []Term
+	if ref, ok := Deref(goal.Term.Args[0]).(*Ref); ok {
+		goals = frozenGoals(ref)
+	}
+	var conj Term = Atom("true")
+	for i := len(goals) - 1; i >= 0; i-- {
+		g := Struct{"freeze", []Term{goal.Term.Args[0], goals[i]}}
+		if i == len(goals)-1 {
+			conj = g
+		} else {
+			conj = Struct{",", []Term{g, conj}}
+		}
+	}
+	return isSuccess(s.Unify(conj, goal.Term.Args[1]))
+}
+
+// --- dif/2 ---
+
+// unifier returns the refs that would be bound by unifying both terms, without binding them,
+// or false if they don't unify. When a ref would be bound to another ref, both are returned.
+func unifier(t1, t2 Term) ([]*Ref, bool) {
+	subst := make(map[*Ref]Term)
+	var refs []*Ref
+	walk := func(t Term) Term {
+		for {
+			t = Deref(t)
+			ref, ok := t.(*Ref)
+			if !ok {
+				return t
+			}
+			value, ok := subst[ref]
+			if !ok {
+				return t
+			}
+			t = value
+		}
+	}
+	var unify func(t1, t2 Term) bool
+	unify = func(t1, t2 Term) bool {
+		t1, t2 = walk(t1), walk(t2)
+		s1, isStruct1 := t1.(Struct)
+		s2, isStruct2 := t2.(Struct)
+		if isStruct1 && isStruct2 {
+			if s1.Name != s2.Name || len(s1.Args) != len(s2.Args) {
+				return false
+			}
+			for i := range s1.Args {
+				if !unify(s1.Args[i], s2.Args[i]) {
+					return false
+				}
+			}
+			return true
+		}
+		if t1 == t2 {
+			return true
+		}
+		if _, ok := t1.(*Ref); !ok {
+			t1, t2 = t2, t1
+		}
+		ref, ok := t1.(*Ref)
+		if !ok {
+			return false
+		}
+		subst[ref] = t2
+		refs = append(refs, ref)
+		if ref2, ok := t2.(*Ref); ok {
+			refs = append(refs, ref2)
+		}
+		return true
+	}
+	if !unify(t1, t2) {
+		return nil, false
+	}
+	return refs, true
+}
+
+// difBuiltin succeeds if both terms can't become equal. If they may become equal depending
+// on future bindings, the constraint is suspended on the refs involved, and is checked
+// again when any of them is bound.
+func difBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	x, y := goal.Term.Args[0], goal.Term.Args[1]
+	refs, ok := unifier(x, y)
+	if !ok {
+		return isSuccess(true)
+	}
+	if len(refs) == 0 {
+		return isSuccess(false)
+	}
+	pair := Struct{"-", []Term{x, y}}
+	for _, ref := range refs {
+		appendAttr(s, ref, "dif", pair)
+	}
+	return isSuccess(true)
+}
+
+// difHookBuiltin checks again all constraints suspended on the bound ref.
+func difHookBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	pairs, _ := ToList(Deref(goal.Term.Args[0]))
+	goals := make([]Goal, len(pairs))
+	for i, pair := range pairs {
+		goals[i] = Goal{Term: Struct{"dif", Deref(pair).(Struct).Args}}
+	}
+	return hasContinuation(goals)
+}
+
+// --- when/2 ---
+
+// whenTriggers evaluates a when/2 condition, returning whether it's satisfied, or the refs
+// that may change its value when bound.
+func whenTriggers(cond Term, ctx Indicator) (bool, []*Ref, error) {
+	cond = Deref(cond)
+	c, ok := cond.(Struct)
+	if !ok {
+		return false, nil, typeOrInstantiationError("callable", cond, ctx)
+	}
+	switch c.Indicator() {
+	case Indicator{Name: "nonvar", Arity: 1}:
+		if ref, ok := Deref(c.Args[0]).(*Ref); ok {
+			return false, []*Ref{ref}, nil
+		}
+		return true, nil, nil
+	case Indicator{Name: "ground", Arity: 1}:
+		if refs := termVariables(c.Args[0]); len(refs) > 0 {
+			return false, refs[:1], nil
+		}
+		return true, nil, nil
+	case Indicator{Name: "?=", Arity: 2}:
+		refs, ok := unifier(c.Args[0], c.Args[1])
+		if !ok || len(refs) == 0 {
+			return true, nil, nil
+		}
+		return false, refs, nil
+	case Indicator{Name: ",", Arity: 2}:
+		done, refs, err := whenTriggers(c.Args[0], ctx)
+		if !done || err != nil {
+			return done, refs, err
+		}
+		return whenTriggers(c.Args[1], ctx)
+	case Indicator{Name: ";", Arity: 2}:
+		done1, refs1, err := whenTriggers(c.Args[0], ctx)
+		if done1 || err != nil {
+			return done1, nil, err
+		}
+		done2, refs2, err := whenTriggers(c.Args[1], ctx)
+		if done2 || err != nil {
+			return done2, nil, err
+		}
+		return false, append(refs1, refs2...), nil
+	default:
+		return false, nil, domainError("when_condition", cond, ctx)
+	}
+}
+
+// whenBuiltin executes 'Goal' when 'Cond' is satisfied, which may be a conjunction or
+// disjunction of nonvar/1, ground/1 and ?=/2 conditions.
+func whenBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	cond, g := goal.Term.Args[0], goal.Term.Args[1]
+	if _, _, err := whenTriggers(cond, goal.Term.Indicator()); err != nil {
+		return isError(err)
+	}
+	// 'Done' is bound when the goal executes, so that it's executed only once even if
+	// suspended on multiple refs.
+	return hasContinuation([]Goal{{Term: Struct{"$when", []Term{s.NewRef("Done"), cond, g}}}})
+}
+
+func whenCheckBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	done, cond, g := goal.Term.Args[0], goal.Term.Args[1], goal.Term.Args[2]
+	ref, ok := Deref(done).(*Ref)
+	if !ok {
+		return isSuccess(true)
+	}
+	ok, refs, err := whenTriggers(cond, Indicator{Name: "when", Arity: 2})
+	if err != nil {
+		return isError(err)
+	}
+	if ok {
+		s.Unify(ref, Atom("true"))
+		return hasContinuation(callGoals([]Term{g}))
+	}
+	for _, trigger := range refs {
+		appendAttr(s, trigger, "when", goal.Term)
+	}
+	return isSuccess(true)
+}
+
+// whenHookBuiltin checks again all conditions suspended on the bound ref.
+func whenHookBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	checks, _ := ToList(Deref(goal.Term.Args[0]))
+	goals := make([]Goal, len(checks))
+	for i, check := range checks {
+		goals[i] = Goal{Term: Deref(check).(Struct)}
+	}
+	return hasContinuation(goals)
+}
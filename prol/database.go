@@ -1,13 +1,19 @@
 package prol
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"iter"
 	"log"
 	"maps"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/brunokim/prol-go/kif"
 	"github.com/brunokim/prol-go/profiler"
@@ -15,13 +21,63 @@ import (
 
 // --- Database ---
 
+// Database holds the predicates available to queries.
+//
+// It's safe for concurrent use: queries may run in parallel, while asserts and retracts are
+// serialized. Rule slices are never modified in place, so a query iterating over the rules
+// of a predicate doesn't need to hold the lock.
+//
+// A database may be forked into cheap snapshots, that share all data with the original until
+// either is modified. Maps are copied on the first modification after a fork, and rule
+// indices are copied on the first modification of their predicate.
 type Database struct {
+	// Guards all fields below, except Logger and CPUProfiler.
+	mu sync.RWMutex
+	// Version of the rule indices that may be modified in place. Indices with an older
+	// version are shared with a fork.
+	version uint64
+	// Whether the maps are shared with a fork, and must be copied before being modified.
+	shared      bool
 	indicators  []Indicator
 	index0      map[Indicator][]Rule
 	index1      map[Indicator][]*ruleIndex
 	Logger      *kif.Logger
 	dbg         *debugger
 	CPUProfiler *profiler.CPUProfiler
+	// Behavior when calling a predicate that doesn't exist, in modules that don't set their own.
+	unknown UnknownFlag
+	// Predicates whose answers are memoized, declared with table/1.
+	tabled map[Indicator]bool
+	// Predicates declared with dynamic/1, or modified with assert while running a query.
+	dynamics map[Indicator]bool
+	// Global counters, accessed with flag/3.
+	counters map[Atom]Term
+	// Modules declared with module/2.
+	modules map[Atom]*module
+}
+
+// UnknownFlag is the value of the 'unknown' flag, that determines what happens when
+// calling a predicate that doesn't exist.
+type UnknownFlag int
+
+const (
+	// UnknownError throws an existence error.
+	UnknownError UnknownFlag = iota
+	// UnknownFail fails silently.
+	UnknownFail
+	// UnknownWarning logs a warning and fails.
+	UnknownWarning
+)
+
+var unknownFlagNames = []Atom{"error", "fail", "warning"}
+
+func (f UnknownFlag) String() string {
+	return string(unknownFlagNames[f])
+}
+
+func parseUnknownFlag(name Atom) (UnknownFlag, bool) {
+	i := slices.Index(unknownFlagNames, name)
+	return UnknownFlag(i), i >= 0
 }
 
 // f(1). f(s(a, b)). f(X). f(Y). f(p). f(Z).
@@ -33,10 +89,14 @@ type Database struct {
 // ?- f(W) => [f(1), f(s(a, b)), f(X), f(Y), f(p), f(Z)]
 
 type ruleIndex struct {
+	// Version of the database that created this index.
+	version  uint64
 	isVar    bool
 	byVar    []Rule
 	byAtom   map[Atom][]Rule
 	byInt    map[Int][]Rule
+	byBigInt map[BigInt][]Rule
+	byFloat  map[Float][]Rule
 	byStruct map[Indicator][]Rule
 }
 
@@ -48,22 +108,64 @@ const (
 	structKey
 )
 
-func newRuleIndex(isVar bool) *ruleIndex {
+func newRuleIndex(version uint64, isVar bool) *ruleIndex {
 	if isVar {
-		return &ruleIndex{isVar: true}
+		return &ruleIndex{version: version, isVar: true}
 	}
 	return &ruleIndex{
+		version:  version,
 		isVar:    false,
 		byAtom:   make(map[Atom][]Rule),
 		byInt:    make(map[Int][]Rule),
+		byBigInt: make(map[BigInt][]Rule),
+		byFloat:  make(map[Float][]Rule),
 		byStruct: make(map[Indicator][]Rule),
 	}
 }
 
+// clone returns a copy of the index with the given version. Rule slices are clipped, so that
+// appending to them in either index doesn't modify the other.
+func (index *ruleIndex) clone(version uint64) *ruleIndex {
+	return &ruleIndex{
+		version:  version,
+		isVar:    index.isVar,
+		byVar:    slices.Clip(index.byVar),
+		byAtom:   cloneClipped(index.byAtom),
+		byInt:    cloneClipped(index.byInt),
+		byBigInt: cloneClipped(index.byBigInt),
+		byFloat:  cloneClipped(index.byFloat),
+		byStruct: cloneClipped(index.byStruct),
+	}
+}
+
+// cloneClipped copies a map of slices, clipping each slice to its length.
+func cloneClipped[K comparable, V any](m map[K][]V) map[K][]V {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[K][]V, len(m))
+	for k, v := range m {
+		clone[k] = slices.Clip(v)
+	}
+	return clone
+}
+
+// lastVersion is the last version assigned to a database.
+var lastVersion atomic.Uint64
+
+func nextVersion() uint64 {
+	return lastVersion.Add(1)
+}
+
 func NewDatabase(rules ...Rule) *Database {
 	db := &Database{
-		index0: make(map[Indicator][]Rule),
-		index1: make(map[Indicator][]*ruleIndex),
+		version:  nextVersion(),
+		index0:   make(map[Indicator][]Rule),
+		index1:   make(map[Indicator][]*ruleIndex),
+		tabled:   make(map[Indicator]bool),
+		dynamics: make(map[Indicator]bool),
+		counters: make(map[Atom]Term),
+		modules:  make(map[Atom]*module),
 	}
 	for _, rule := range builtins {
 		db.Assert(rule)
@@ -74,16 +176,77 @@ func NewDatabase(rules ...Rule) *Database {
 	return db
 }
 
-func (db *Database) Clone() *Database {
+// Fork returns a snapshot of the database, that can be modified without affecting the
+// original, and vice versa.
+//
+// It's a cheap operation, since all data is shared until modified by either database.
+func (db *Database) Fork() *Database {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	// Neither database may modify the current indices in place anymore.
+	db.version = nextVersion()
+	db.shared = true
 	return &Database{
-		indicators: slices.Clone(db.indicators),
-		index0:     maps.Clone(db.index0),
-		index1:     maps.Clone(db.index1),
+		version:     nextVersion(),
+		shared:      true,
+		indicators:  db.indicators,
+		index0:      db.index0,
+		index1:      db.index1,
+		Logger:      db.Logger,
+		dbg:         db.dbg,
+		CPUProfiler: db.CPUProfiler,
+		unknown:     db.unknown,
+		tabled:      db.tabled,
+		dynamics:    db.dynamics,
+		counters:    db.counters,
+		modules:     db.modules,
 	}
 }
 
+// Clone returns a copy of the database that is independent of the original. It's the same
+// as Fork.
+func (db *Database) Clone() *Database {
+	return db.Fork()
+}
+
+// own copies the maps shared with a fork, so that they can be modified. Must be called
+// with the lock held, before any modification.
+func (db *Database) own() {
+	if !db.shared {
+		return
+	}
+	db.shared = false
+	db.indicators = slices.Clip(db.indicators)
+	db.index0 = cloneClipped(db.index0)
+	db.index1 = cloneClipped(db.index1)
+	db.tabled = maps.Clone(db.tabled)
+	db.dynamics = maps.Clone(db.dynamics)
+	db.counters = maps.Clone(db.counters)
+	db.modules = cloneModules(db.modules)
+	if db.dbg != nil {
+		db.dbg = &debugger{breakpoints: maps.Clone(db.dbg.breakpoints)}
+	}
+}
+
+func cloneModules(modules map[Atom]*module) map[Atom]*module {
+	clone := make(map[Atom]*module, len(modules))
+	for name, m := range modules {
+		clone[name] = &module{exports: slices.Clone(m.exports), imports: maps.Clone(m.imports), unknown: m.unknown}
+	}
+	return clone
+}
+
 func (db *Database) Assert(rule Rule) {
-	f := rule.Indicator()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.assert("", rule)
+}
+
+// assert adds a rule after all other rules of its predicate, asserting it into the module
+// unless its head is qualified.
+func (db *Database) assert(module Atom, rule Rule) Indicator {
+	db.own()
+	rule, f := moduleRule(module, rule)
 	if _, ok := db.index0[f]; !ok {
 		db.indicators = append(db.indicators, f)
 	}
@@ -92,6 +255,86 @@ func (db *Database) Assert(rule Rule) {
 	if dcg, ok := rule.(DCG); ok {
 		db.Logger.Info(kif.KV{"msg", "DCG clause"}, kif.KV{"clause", dcg.clause})
 	}
+	db.indexRule(f, rule)
+	return f
+}
+
+// Asserta adds a rule before all other rules of its predicate.
+//
+// Rule slices are never modified in place, so that calls iterating over the predicate's
+// rules are not affected, following the logical update view.
+func (db *Database) Asserta(rule Rule) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.asserta("", rule)
+}
+
+// asserta is like assert, but adds the rule before all other rules of its predicate.
+func (db *Database) asserta(module Atom, rule Rule) Indicator {
+	db.own()
+	rule, f := moduleRule(module, rule)
+	if _, ok := db.index0[f]; !ok {
+		db.indicators = append(db.indicators, f)
+	}
+	db.Logger.Info(kif.KV{"msg", "asserta rule"}, kif.KV{"rule", rule})
+	db.reindex(f, slices.Concat([]Rule{rule}, db.index0[f]))
+	return f
+}
+
+// Retract removes a rule from its predicate, returning false if it was already removed.
+func (db *Database) Retract(f Indicator, rule Rule) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	i := slices.IndexFunc(db.index0[f], func(other Rule) bool { return sameRule(rule, other) })
+	if i < 0 {
+		return false
+	}
+	db.own()
+	db.Logger.Info(kif.KV{"msg", "retract rule"}, kif.KV{"rule", rule})
+	db.reindex(f, slices.Delete(slices.Clone(db.index0[f]), i, i+1))
+	return true
+}
+
+// Abolish removes a predicate and all its rules from the database.
+func (db *Database) Abolish(ind Indicator) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.index0[ind]; !ok {
+		return
+	}
+	db.own()
+	db.Logger.Info(kif.KV{"msg", "abolish"}, kif.KV{"indicator", ind})
+	db.indicators = slices.DeleteFunc(slices.Clone(db.indicators), func(other Indicator) bool { return other == ind })
+	delete(db.index0, ind)
+	delete(db.index1, ind)
+	delete(db.tabled, ind)
+	delete(db.dynamics, ind)
+}
+
+// IsStatic returns whether the predicate is implemented in Go, and can't be modified.
+func (db *Database) IsStatic(ind Indicator) bool {
+	if _, ok := controlConstructs[ind]; ok {
+		return true
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return slices.ContainsFunc(db.index0[ind], func(rule Rule) bool {
+		_, ok := rule.(Builtin)
+		return ok
+	})
+}
+
+// reindex replaces the rules of a predicate, rebuilding its first-argument index.
+func (db *Database) reindex(f Indicator, rules []Rule) {
+	db.index0[f] = rules
+	delete(db.index1, f)
+	for _, rule := range rules {
+		db.indexRule(f, rule)
+	}
+}
+
+// indexRule appends the rule to the first-argument index of its predicate.
+func (db *Database) indexRule(f Indicator, rule Rule) {
 	// Populate index1 from first arg type.
 	var firstArg Term
 	switch c := rule.(type) {
@@ -114,10 +357,14 @@ func (db *Database) Assert(rule Rule) {
 	_, isVar := firstArg.(Var)
 	indices, ok := db.index1[f]
 	if !ok || indices[len(indices)-1].isVar != isVar {
-		db.index1[f] = append(indices, newRuleIndex(isVar))
+		indices = append(indices, newRuleIndex(db.version, isVar))
+	} else if n := len(indices); indices[n-1].version != db.version {
+		// Copy index shared with a fork before modifying it.
+		indices = slices.Clone(indices)
+		indices[n-1] = indices[n-1].clone(db.version)
 	}
-	n := len(db.index1[f])
-	lastIndex := db.index1[f][n-1]
+	db.index1[f] = indices
+	lastIndex := indices[len(indices)-1]
 	// Append rule to index.
 	lastIndex.byVar = append(lastIndex.byVar, rule)
 	switch t := firstArg.(type) {
@@ -125,6 +372,10 @@ func (db *Database) Assert(rule Rule) {
 		lastIndex.byAtom[t] = append(lastIndex.byAtom[t], rule)
 	case Int:
 		lastIndex.byInt[t] = append(lastIndex.byInt[t], rule)
+	case BigInt:
+		lastIndex.byBigInt[t] = append(lastIndex.byBigInt[t], rule)
+	case Float:
+		lastIndex.byFloat[t] = append(lastIndex.byFloat[t], rule)
 	case Struct:
 		lastIndex.byStruct[t.Indicator()] = append(lastIndex.byStruct[t.Indicator()], rule)
 	case Var:
@@ -135,12 +386,159 @@ func (db *Database) Assert(rule Rule) {
 }
 
 func (db *Database) PredicateExists(ind Indicator) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	_, ok := db.index0[ind]
 	return ok
 }
 
+// GetPredicate returns the rules of a predicate.
+func (db *Database) GetPredicate(ind Indicator) []Rule {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.index0[ind]
+}
+
+// PutPredicate replaces all rules of a predicate, returning false if any rule belongs to
+// another predicate.
+func (db *Database) PutPredicate(ind Indicator, rules []Rule) bool {
+	for i, rule := range rules {
+		if rule.Indicator() != ind {
+			log.Printf("put_predicate: arg #%d: want %v, got %v", i+1, ind, rule.Indicator())
+			return false
+		}
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.own()
+	if _, ok := db.index0[ind]; ok {
+		// Clear existing predicate.
+		delete(db.index0, ind)
+		if ind.Arity > 0 {
+			delete(db.index1, ind)
+		}
+	}
+	// Otherwise, assert all other rules.
+	for _, rule := range rules {
+		db.assert(ind.Module, rule)
+	}
+	return true
+}
+
+// Predicates returns the indicators of all predicates in the database, in order of creation.
+func (db *Database) Predicates() []Indicator {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var inds []Indicator
+	seen := make(map[Indicator]bool)
+	for _, ind := range db.indicators {
+		if _, ok := db.index0[ind]; !ok || seen[ind] {
+			// Indicator was deleted, or recreated with put_predicate.
+			continue
+		}
+		seen[ind] = true
+		inds = append(inds, ind)
+	}
+	return inds
+}
+
+// Dynamic declares a predicate, so that calling it without clauses fails instead of being
+// handled as unknown.
+func (db *Database) Dynamic(ind Indicator) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.dynamic(ind)
+}
+
+func (db *Database) dynamic(ind Indicator) {
+	db.declare(ind)
+	db.own()
+	db.dynamics[ind] = true
+}
+
+// declare creates a predicate without clauses, if it doesn't exist.
+func (db *Database) declare(ind Indicator) {
+	if _, ok := db.index0[ind]; ok {
+		return
+	}
+	db.own()
+	db.indicators = append(db.indicators, ind)
+	db.index0[ind] = nil
+}
+
+// IsDynamic returns whether the predicate was declared with dynamic/1, or modified with
+// assert by a query. Predicates loaded from a text are static otherwise.
+func (db *Database) IsDynamic(ind Indicator) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.dynamics[ind]
+}
+
+// Table declares a predicate as tabled, so that calls to it are evaluated once for each
+// variant, and its answers are memoized until the end of the query.
+func (db *Database) Table(ind Indicator) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.declare(ind)
+	db.own()
+	db.tabled[ind] = true
+}
+
+// isTabled returns whether the predicate was declared with table/1.
+func (db *Database) isTabled(ind Indicator) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.tabled[ind]
+}
+
+// debugger returns the debugger, or nil if no breakpoint was ever set.
+func (db *Database) debugger() *debugger {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.dbg
+}
+
+// Unknown returns the default value of the 'unknown' flag, for modules that don't set it.
+func (db *Database) Unknown() UnknownFlag {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.unknown
+}
+
+// SetUnknown modifies the default value of the 'unknown' flag.
+func (db *Database) SetUnknown(flag UnknownFlag) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.unknown = flag
+}
+
+// ModuleUnknown returns the value of the 'unknown' flag in a module, falling back to the
+// database default.
+func (db *Database) ModuleUnknown(name Atom) UnknownFlag {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if m, ok := db.modules[name]; ok && m.unknown != nil {
+		return *m.unknown
+	}
+	return db.unknown
+}
+
+// SetModuleUnknown modifies the value of the 'unknown' flag in a module.
+func (db *Database) SetModuleUnknown(name Atom, flag UnknownFlag) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.own()
+	db.getModule(name).unknown = &flag
+}
+
 func (db *Database) Matching(goal Goal) []Rule {
-	f := goal.Term.Indicator()
+	return db.matching(goal.Term.Indicator(), goal)
+}
+
+// matching returns the rules of the predicate that may unify with the goal.
+func (db *Database) matching(f Indicator, goal Goal) []Rule {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	indices, ok := db.index1[f]
 	if !ok {
 		return db.index0[f]
@@ -160,6 +558,10 @@ func (db *Database) Matching(goal Goal) []Rule {
 			rules = append(rules, index.byAtom[t]...)
 		case Int:
 			rules = append(rules, index.byInt[t]...)
+		case BigInt:
+			rules = append(rules, index.byBigInt[t]...)
+		case Float:
+			rules = append(rules, index.byFloat[t]...)
 		case Struct:
 			rules = append(rules, index.byStruct[t.Indicator()]...)
 		default:
@@ -169,14 +571,21 @@ func (db *Database) Matching(goal Goal) []Rule {
 	return rules
 }
 
-func (db *Database) Solve(query Clause, opts ...any) (iter.Seq[Solution], func() error) {
+// Solve returns an iterator over the solutions of the query, and a function returning the
+// error that stopped the iteration, if any. Invalid options are also reported as an error.
+func (db *Database) Solve(query Clause, opts ...SolveOption) (iter.Seq[Solution], func() error) {
 	env := make(map[Var]*Ref)
-	query = varToRef(query, env).(Clause)
-	s := newSolver(db, env, opts...)
-	var err error
+	s, err := newSolver(db, env, opts...)
+	if err != nil {
+		return func(yield func(Solution) bool) {}, func() error { return err }
+	}
+	query = varToRef(query, env, s.NewRef).(Clause)
 	seq := func(yield func(Solution) bool) {
+		if err = s.ctx.Err(); err != nil {
+			return
+		}
 		s.yield = yield
-		err = s.dfs(newEnvironment(query))
+		err = s.run(newEnvironment(query))
 	}
 	errFn := func() error {
 		return err
@@ -184,18 +593,30 @@ func (db *Database) Solve(query Clause, opts ...any) (iter.Seq[Solution], func()
 	return seq, errFn
 }
 
-func (db *Database) FirstSolution(query Clause, opts ...any) (Solution, error) {
+// SolveContext is like Solve, but stops the search when the context is done, returning the
+// context's error.
+func (db *Database) SolveContext(ctx context.Context, query Clause, opts ...SolveOption) (iter.Seq[Solution], func() error) {
+	return db.Solve(query, slices.Concat(opts, []SolveOption{WithContext(ctx)})...)
+}
+
+// errNoSolutions is returned by FirstSolution when the query fails.
+var errNoSolutions = errors.New("expecting at least one solution")
+
+func (db *Database) FirstSolution(query Clause, opts ...SolveOption) (Solution, error) {
 	seq, errFn := db.Solve(query, opts...)
 	next, stop := iter.Pull(seq)
 	defer stop()
 	solution, ok := next()
 	if !ok {
-		return nil, fmt.Errorf("expecting at least one solution: %v", query)
+		if err := errFn(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errNoSolutions, query)
 	}
 	return solution, errFn()
 }
 
-func (db *Database) Query(text string, opts ...any) (Rule, error) {
+func (db *Database) Query(text string, opts ...SolveOption) (Rule, error) {
 	chars := FromString("query :- " + text)
 	query := Clause{
 		Goal{Term: Struct{"query", nil}},
@@ -221,7 +642,12 @@ func (db *Database) Query(text string, opts ...any) (Rule, error) {
 	return rule, nil
 }
 
-func (db *Database) Interpret(text string, opts ...any) error {
+// Interpret asserts the rules and executes the directives in the text.
+//
+// Rules are asserted into the module declared in the text, if any, or into the user module.
+func (db *Database) Interpret(text string, opts ...SolveOption) error {
+	// The module declared by the text is shared by the queries that assert its rules.
+	opts = slices.Concat(opts, []SolveOption{withLoadContext(&loadContext{loading: true})})
 	chars := FromString(text)
 	for {
 		query := Clause{
@@ -231,9 +657,14 @@ func (db *Database) Interpret(text string, opts ...any) error {
 			Goal{Term: Struct{"assertz", []Term{v("Rule")}}},
 		}
 		solution, err := db.FirstSolution(query, opts...)
-		if err != nil {
+		if errors.Is(err, errNoSolutions) {
+			// No more rules to parse.
 			break
 		}
+		if err != nil {
+			// Exceptions from directives are returned unchanged.
+			return err
+		}
 		chars = solution[v("Rest")]
 	}
 	db.Logger.Info(kif.KV{"msg", "finished asserts"})
@@ -257,13 +688,37 @@ func (db *Database) Interpret(text string, opts ...any) error {
 
 type Solver interface {
 	GetPredicate(ind Indicator) []Rule
+	PredicateExists(ind Indicator) bool
+	Predicates() []Indicator
 	PutPredicate(ind Indicator, rules []Rule) bool
 	Assert(rule Rule)
+	Dynamic(ind Indicator)
+	Table(ind Indicator)
+	Asserta(rule Rule)
+	Retract(ind Indicator, rule Rule) bool
+	DeclareModule(name Atom, exports []Indicator)
+	Import(from Atom, inds []Indicator) bool
+	Abolish(ind Indicator)
+	IsStatic(ind Indicator) bool
+	IsDynamic(ind Indicator) bool
+	Global(name Atom) (Term, bool)
+	SetGlobal(name Atom, value Term, backtrackable bool)
+	Counter(key Atom) Term
+	SetCounter(key Atom, value Term)
+	UpdateCounter(key Atom, update func(old Term) (Term, error)) error
+	Flag(module, name Atom) (Term, bool)
+	SetFlag(module, name Atom, value Term) error
 	Unify(t1, t2 Term) bool
+	UnifyWithOccursCheck(t1, t2 Term) bool
 	Unwind() func() bool
+	SetArg(t Struct, n int, value Term)
+	PutAttr(ref *Ref, module Atom, value Term)
+	DelAttr(ref *Ref, module Atom)
+	FindAll(template, goal Term) ([]Term, error)
 	Interpret(text string) error
 	PutBreakpoint(ind Indicator) bool
 	ClearBreakpoint(ind Indicator) bool
+	NewRef(v Var) *Ref
 }
 
 type Solution map[Var]Term
@@ -276,63 +731,205 @@ func (MaxSolutionsError) Error() string  { return "max solutions reached" }
 func (MaxDepthError) Error() string      { return "max depth reached" }
 func (StopIterationError) Error() string { return "stop iteration" }
 
+// MaxInferencesError is returned when the number of goals executed by a query exceeds the
+// "max_inferences" option.
+type MaxInferencesError struct {
+	Inferences int
+}
+
+func (err MaxInferencesError) Error() string {
+	return fmt.Sprintf("max inferences reached: %d", err.Inferences)
+}
+
+// Number of inferences between checks for the context's cancellation.
+const contextCheckInterval = 1024
+
 type solver struct {
 	db    *Database
 	env   map[Var]*Ref
-	trail []*Ref
+	trail []trailEntry
 	yield func(Solution) bool
+	// Choice points of the search, from oldest to newest.
+	choices []*choicePoint
+	// Number of nested runs of the search, from FindAll calls.
+	runs int
+	// Stack of solutions collected by nested FindAll calls.
+	bags [][]Term
+	// Goals woken by binding attributed refs, to be executed after the current unification.
+	wakeups []Goal
+	// Answer tables of tabled predicates, by variant of the call.
+	tables map[string]*table
+	// Tables being evaluated, from oldest to newest.
+	tableStack []*table
+	// Number of answers added to any table, used to detect a fixpoint.
+	numAnswers int
+	// Global variables, accessed with b_setval/2 and nb_setval/2.
+	globals map[Atom]Term
+	// Source and id of the last ref created within the query.
+	refSrc int64
+	refID  int
+	// Context of the query, checked periodically for cancellation.
+	ctx context.Context
+	// Context of the source text being loaded, with the module of asserted rules.
+	load *loadContext
+	// Predicate calls that are still executing, and those entered in the CPU profiler.
+	frame, profiled *profileFrame
 	// Opts
-	depth        int
-	maxDepth     int
-	numSolutions int
-	limit        int
-}
-
-func newSolver(db *Database, env map[Var]*Ref, opts ...any) *solver {
-	s := &solver{db: db, env: env}
-	for i := 0; i < len(opts); {
-		switch opts[i] {
-		case "max_depth":
-			s.maxDepth = opts[i+1].(int)
-			i += 2
-		case "limit":
-			s.limit = opts[i+1].(int)
-			i += 2
-		default:
-			log.Printf("unknown option at %d: %v\n", i, opts[i])
-			i += 1
-		}
+	depth         int
+	maxDepth      int
+	numSolutions  int
+	limit         int
+	occursCheck   bool
+	numInferences int
+	maxInferences int
+	trace         io.Writer
+}
+
+func newSolver(db *Database, env map[Var]*Ref, opts ...SolveOption) (*solver, error) {
+	o, err := newSolveOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	load := o.load
+	if load == nil {
+		load = &loadContext{}
 	}
-	return s
+	return &solver{
+		db:            db,
+		env:           env,
+		ctx:           o.Context,
+		load:          load,
+		tables:        make(map[string]*table),
+		globals:       make(map[Atom]Term),
+		refSrc:        numSolvers.Add(1),
+		maxDepth:      o.MaxDepth,
+		limit:         o.Limit,
+		occursCheck:   o.OccursCheck,
+		maxInferences: o.MaxInferences,
+		trace:         o.Trace,
+	}, nil
+}
+
+// NewRef creates a fresh reference, with an id that orders it after all refs created
+// before within the query.
+func (s *solver) NewRef(v Var) *Ref {
+	s.refID++
+	return &Ref{name: v, src: s.refSrc, id: s.refID}
 }
 
 func (s *solver) GetPredicate(ind Indicator) []Rule {
-	return s.db.index0[ind]
+	return s.db.GetPredicate(ind)
+}
+
+func (s *solver) PredicateExists(ind Indicator) bool {
+	return s.db.PredicateExists(ind)
+}
+
+func (s *solver) Predicates() []Indicator {
+	return s.db.Predicates()
 }
 
 func (s *solver) PutPredicate(ind Indicator, rules []Rule) bool {
-	for i, rule := range rules {
-		if rule.Indicator() != ind {
-			log.Printf("put_predicate: arg #%d: want %v, got %v", i+1, ind, rule.Indicator())
-			return false
-		}
+	return s.db.PutPredicate(ind, rules)
+}
+
+// Assert adds a rule into the current module of the query.
+func (s *solver) Assert(rule Rule) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	f := s.db.assert(s.load.module, rule)
+	if !s.load.loading {
+		s.db.dynamics[f] = true
 	}
-	if _, ok := s.db.index0[ind]; ok {
-		// Clear existing predicate.
-		delete(s.db.index0, ind)
-		if ind.Arity > 0 {
-			delete(s.db.index1, ind)
-		}
+}
+
+// Asserta adds a rule into the current module of the query, before all other rules.
+func (s *solver) Asserta(rule Rule) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	f := s.db.asserta(s.load.module, rule)
+	if !s.load.loading {
+		s.db.dynamics[f] = true
 	}
-	// Otherwise, assert all other rules.
-	for _, rule := range rules {
-		s.db.Assert(rule)
+}
+
+func (s *solver) Retract(ind Indicator, rule Rule) bool {
+	return s.db.Retract(ind, rule)
+}
+
+func (s *solver) Abolish(ind Indicator) {
+	s.db.Abolish(ind)
+}
+
+func (s *solver) IsStatic(ind Indicator) bool {
+	return s.db.IsStatic(ind)
+}
+
+func (s *solver) IsDynamic(ind Indicator) bool {
+	return s.db.IsDynamic(ind)
+}
+
+// Dynamic declares a predicate, within the current module of the query if unqualified.
+func (s *solver) Dynamic(ind Indicator) {
+	if ind.Module == "" {
+		ind.Module = s.load.module
 	}
-	return true
+	s.db.Dynamic(ind)
 }
 
-func (s *solver) Assert(rule Rule) {
-	s.db.Assert(rule)
+// Table declares a tabled predicate, within the current module of the query if unqualified.
+func (s *solver) Table(ind Indicator) {
+	if ind.Module == "" {
+		ind.Module = s.load.module
+	}
+	s.db.Table(ind)
+}
+
+// Flag returns the value of a Prolog flag, or false if it doesn't exist. Flags local to a
+// module are read from the given module, or the current module of the query if empty.
+func (s *solver) Flag(module, name Atom) (Term, bool) {
+	if module == "" {
+		module = s.load.module
+	}
+	switch name {
+	case "unknown":
+		return Atom(s.db.ModuleUnknown(module).String()), true
+	case "occurs_check":
+		return Atom(strconv.FormatBool(s.occursCheck)), true
+	default:
+		return nil, false
+	}
+}
+
+// SetFlag modifies the value of a Prolog flag. Flags local to a module are set in the given
+// module, or the current module of the query if empty.
+func (s *solver) SetFlag(module, name Atom, value Term) error {
+	if module == "" {
+		module = s.load.module
+	}
+	ctx := Indicator{Name: "set_prolog_flag", Arity: 2}
+	value = Deref(value)
+	if _, ok := value.(*Ref); ok {
+		return instantiationError(ctx)
+	}
+	switch name {
+	case "unknown":
+		atom, ok := value.(Atom)
+		flag, ok2 := parseUnknownFlag(atom)
+		if !ok || !ok2 {
+			return domainError("flag_value", Struct{"+", []Term{name, value}}, ctx)
+		}
+		s.db.SetModuleUnknown(module, flag)
+		return nil
+	case "occurs_check":
+		if value != Atom("true") && value != Atom("false") {
+			return domainError("flag_value", Struct{"+", []Term{name, value}}, ctx)
+		}
+		s.occursCheck = value == Atom("true")
+		return nil
+	default:
+		return domainError("prolog_flag", name, ctx)
+	}
 }
 
 func (s *solver) Interpret(text string) error {
@@ -340,6 +937,9 @@ func (s *solver) Interpret(text string) error {
 }
 
 func (s *solver) PutBreakpoint(ind Indicator) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.own()
 	if s.db.dbg == nil {
 		s.db.dbg = newDebugger()
 	}
@@ -348,9 +948,12 @@ func (s *solver) PutBreakpoint(ind Indicator) bool {
 }
 
 func (s *solver) ClearBreakpoint(ind Indicator) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
 	if s.db.dbg == nil {
 		return false
 	}
+	s.db.own()
 	s.db.dbg.clearBreakpoint(ind)
 	return true
 }
@@ -359,20 +962,49 @@ func (s *solver) ClearBreakpoint(ind Indicator) bool {
 
 func (s *solver) solution() Solution {
 	m := make(Solution)
+	refs := make(map[*Ref]*Ref)
 	for x, ref := range s.env {
 		if x[0] == '_' {
 			continue
 		}
-		m[x] = RefToTerm(ref)
+		m[x] = detach(RefToTerm(ref), refs)
 	}
 	return m
 }
 
+// detach replaces the unbound refs within t by copies with the same name and id.
+//
+// Bindings are not undone when there are no choice points left, so solutions must not share
+// refs that may be bound later in the search.
+func detach(t Term, refs map[*Ref]*Ref) Term {
+	switch t := t.(type) {
+	case *Ref:
+		if _, ok := refs[t]; !ok {
+			refs[t] = &Ref{name: t.name, src: t.src, id: t.id, attrs: t.attrs}
+		}
+		return refs[t]
+	case Struct:
+		args := make([]Term, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = detach(arg, refs)
+		}
+		return Struct{t.Name, args}
+	default:
+		return t
+	}
+}
+
 // --- Environment
 
+// environment is a linked stack of goal lists that are still to be executed.
+//
+// Each frame records the height of the choice stack when it was pushed, which is the
+// barrier for any cut executed within its goals, and the depth of the goal that pushed it.
 type environment struct {
-	goals  []Goal
-	parent *environment
+	goals      []Goal
+	parent     *environment
+	cutBarrier int
+	depth      int
 }
 
 func newEnvironment(goals []Goal) *environment {
@@ -383,87 +1015,402 @@ func (env *environment) isDone() bool {
 	return env == nil
 }
 
-func (env *environment) next() (Goal, *environment) {
+// next pops the first goal, returning it with its cut barrier and depth. The frame is
+// released before its last goal is executed, so that tail calls don't grow the stack.
+func (env *environment) next() (Goal, int, int, *environment) {
 	goal, rest := env.goals[0], env.goals[1:]
 	if len(rest) > 0 {
-		return goal, &environment{goals: rest, parent: env.parent}
+		return goal, env.cutBarrier, env.depth + 1, &environment{goals: rest, parent: env.parent, cutBarrier: env.cutBarrier, depth: env.depth}
 	}
-	return goal, env.parent
+	return goal, env.cutBarrier, env.depth + 1, env.parent
 }
 
-func (env *environment) push(goals []Goal) *environment {
+// push adds a frame with goals called from the current search depth.
+func (env *environment) push(goals []Goal, cutBarrier int, depth int) *environment {
 	if len(goals) == 0 {
 		return env
 	}
-	return &environment{goals: goals, parent: env}
+	return &environment{goals: goals, parent: env, cutBarrier: cutBarrier, depth: depth}
+}
+
+// --- Choice points
+
+// choicePoint records the state to be restored on backtracking, and how to try the
+// remaining alternatives of the goal that created it.
+type choicePoint struct {
+	// Length of the trail and of the pending wakeups when created.
+	trail, wakeups int
+	// Depth of the goal that created it.
+	depth int
+	// next tries the remaining alternatives, and returns the continuation of the first one
+	// that succeeds, or false if none do. It's nil for choice points that only mark a position
+	// in the stack, and that are removed on backtracking.
+	next func(cp *choicePoint) (*environment, bool, error)
+	// Whether there are no alternatives left, so the choice point may be removed.
+	done bool
+	// State of a catch/3 call, if the choice point marks one.
+	catch *catchFrame
+	// Predicate calls executing when created.
+	frame *profileFrame
+}
+
+// pushChoice adds a choice point to the stack, that restores the current state.
+func (s *solver) pushChoice(next func(cp *choicePoint) (*environment, bool, error)) *choicePoint {
+	cp := &choicePoint{trail: len(s.trail), wakeups: len(s.wakeups), depth: s.depth, next: next, frame: s.frame}
+	s.choices = append(s.choices, cp)
+	return cp
+}
+
+// restore undoes all changes since the choice point was created.
+func (s *solver) restore(cp *choicePoint) {
+	s.undo(cp.trail, cp.wakeups)
+	s.depth = cp.depth
+	s.frame = cp.frame
+}
+
+// cut removes all choice points above the barrier.
+func (s *solver) cut(cutBarrier int) {
+	if len(s.choices) <= cutBarrier {
+		return
+	}
+	s.db.Logger.Log(kif.DEBUG, kif.KV{"msg", "cut"}, kif.KV{"depth", s.depth})
+	clear(s.choices[cutBarrier:])
+	s.choices = s.choices[:cutBarrier]
 }
 
 // ---
 
-func (s *solver) dfs(env *environment) error {
-	if env.isDone() {
-		// Found a solution
-		if !s.yield(s.solution()) {
-			return StopIterationError{}
+// run executes the goals in env, backtracking into the choice points created since it
+// started until there are no alternatives left.
+//
+// The search is a loop over an explicit goal and choice point stack, so the Go stack doesn't
+// grow with the depth of the search. Nested runs only happen for FindAll.
+func (s *solver) run(env *environment) error {
+	base := len(s.choices)
+	trail, wakeups, depth, frame := len(s.trail), len(s.wakeups), s.depth, s.frame
+	s.runs++
+	defer func() {
+		s.cut(base)
+		s.undo(trail, wakeups)
+		s.depth = depth
+		s.frame = frame
+		s.profile()
+		s.runs--
+	}()
+	ok := true
+	for {
+		var err error
+		switch {
+		case !ok:
+			env, ok, err = s.backtrack(base)
+			if err == nil && !ok {
+				s.db.Logger.Log(kif.DEBUG, kif.KV{"msg", "backtrack"}, kif.KV{"depth", s.depth})
+				return nil
+			}
+		case env.isDone():
+			// Found a solution
+			s.frame = frame
+			s.profile()
+			if !s.yield(s.solution()) {
+				return StopIterationError{}
+			}
+			s.numSolutions++
+			if s.limit > 0 && s.numSolutions >= s.limit {
+				return MaxSolutionsError{}
+			}
+			ok = false
+		default:
+			if s.runs == 1 && len(s.choices) == 0 {
+				// Without choice points the search never backtracks, so the trail is not needed.
+				clear(s.trail)
+				s.trail = s.trail[:0]
+			}
+			env, ok, err = s.step(env)
+		}
+		if err != nil {
+			env, ok, err = s.throw(err, base)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// backtrack restores the newest choice point above base, and tries its alternatives.
+func (s *solver) backtrack(base int) (*environment, bool, error) {
+	for len(s.choices) > base {
+		cp := s.choices[len(s.choices)-1]
+		s.restore(cp)
+		if cp.next == nil {
+			s.cut(len(s.choices) - 1)
+			continue
 		}
-		s.numSolutions++
-		if s.limit > 0 && s.numSolutions >= s.limit {
-			return MaxSolutionsError{}
+		env, ok, err := cp.next(cp)
+		if cp.done {
+			// Remove it before executing the last alternative, to allow last-call optimization.
+			s.choices[len(s.choices)-1] = nil
+			s.choices = s.choices[:len(s.choices)-1]
 		}
-		return nil
+		if err != nil || ok {
+			return env, ok, err
+		}
+	}
+	return nil, false, nil
+}
+
+// throw unwinds the choice stack until a catch/3 frame whose catcher unifies with the
+// exception, and returns the continuation with its recovery goal.
+//
+// Errors that are not Prolog exceptions, or that reach the base of the stack, are returned.
+func (s *solver) throw(err error, base int) (*environment, bool, error) {
+	ball, ok := err.(*PrologError)
+	if !ok {
+		return nil, false, err
 	}
-	goal, env := env.next()
+	// Exceptions raised by builtins have refs from the package's counter, so they're renamed
+	// with refs from the solver before being unified with terms from the query.
+	term := copyTerm(ball.Term, make(map[*Ref]*Ref), s.NewRef)
+	for i := len(s.choices) - 1; i >= base; i-- {
+		cp := s.choices[i]
+		if cp.catch == nil || cp.catch.exited {
+			continue
+		}
+		s.cut(i)
+		s.restore(cp)
+		if !s.Unify(cp.catch.catcher, term) {
+			s.restore(cp)
+			continue
+		}
+		s.db.Logger.Log(kif.DEBUG, kif.KV{"msg", "catch"}, kif.KV{"depth", s.depth}, kif.KV{"ball", term})
+		recovery := []Goal{{Term: Struct{"call", []Term{cp.catch.recovery}}}}
+		return s.wake(cp.catch.env.push(recovery, cp.catch.cutBarrier, s.depth)), true, nil
+	}
+	return nil, false, err
+}
+
+// step executes the first goal in env, returning the continuation, or false if it failed.
+func (s *solver) step(env *environment) (*environment, bool, error) {
+	goal, cutBarrier, depth, env := env.next()
 	ind := goal.Term.Indicator()
-	s.depth++
-	defer func() { s.depth-- }()
+	s.depth = depth
 	s.db.Logger.Log(kif.DEBUG, kif.KV{"msg", "search"}, kif.KV{"depth", s.depth}, kif.KV{"goal", ind})
-	if s.db.CPUProfiler != nil {
-		s.db.CPUProfiler.Enter(profiler.Location{ind.String(), 1})
-		defer s.db.CPUProfiler.Exit()
+	// Predicate calls at this depth or deeper have exited.
+	for s.frame != nil && s.frame.depth >= s.depth {
+		s.frame = s.frame.parent
+	}
+	s.profile()
+	if s.trace != nil {
+		fmt.Fprintf(s.trace, "%*s%v\n", 2*(s.depth-1), "", goal.Term)
 	}
 	// Check call depth.
 	if s.maxDepth > 0 && s.depth > s.maxDepth {
-		return MaxDepthError{}
+		return nil, false, MaxDepthError{}
+	}
+	// Check number of inferences and cancellation.
+	s.numInferences++
+	if s.maxInferences > 0 && s.numInferences > s.maxInferences {
+		return nil, false, MaxInferencesError{Inferences: s.maxInferences}
 	}
+	if s.numInferences%contextCheckInterval == 0 {
+		if err := s.ctx.Err(); err != nil {
+			return nil, false, err
+		}
+	}
+	// Execute control constructs.
+	if control, ok := controlConstructs[ind]; ok {
+		return control(s, goal, cutBarrier, env)
+	}
+	return s.call(goal, s.db.resolve(ind), env)
+}
+
+// call executes the goal with the rules of the predicate ind.
+func (s *solver) call(goal Goal, ind Indicator, env *environment) (*environment, bool, error) {
 	// Check if predicate exists.
 	if !s.db.PredicateExists(ind) {
-		return fmt.Errorf("predicate does not exist for goal: %v", ind)
-	}
-	unwind := s.Unwind()
-	defer unwind()
-	s.db.dbg.checkBreakpoint(ind)
-	for _, rule := range s.db.Matching(goal) {
-		unwind()
-		body, ok, err := rule.Unify(s, goal)
-		if err != nil {
-			return err
-		}
-		if !ok {
-			continue
+		switch s.db.ModuleUnknown(ind.Module) {
+		case UnknownFail:
+			return nil, false, nil
+		case UnknownWarning:
+			if s.db.Logger != nil {
+				s.db.Logger.Warning(kif.KV{"msg", "unknown procedure"}, kif.KV{"goal", ind})
+			} else {
+				log.Printf("unknown procedure: %v", ind)
+			}
+			return nil, false, nil
+		default:
+			return nil, false, existenceError("procedure", indicatorTerm(ind), ind)
 		}
-		if err := s.dfs(env.push(body)); err != nil {
-			return err
+	}
+	if s.db.isTabled(ind) {
+		return s.tabledCall(goal, ind, env)
+	}
+	return s.resolve(goal, ind, env)
+}
+
+// resolve executes the goal with each matching rule, as alternatives of a choice point.
+//
+// The rules' bodies have the choice point's position as cut barrier, so a cut removes it
+// along with all choice points created by the body.
+func (s *solver) resolve(goal Goal, ind Indicator, env *environment) (*environment, bool, error) {
+	s.db.debugger().checkBreakpoint(ind)
+	rules := s.db.matching(ind, goal)
+	if len(rules) == 0 {
+		return nil, false, nil
+	}
+	cutBarrier := len(s.choices)
+	s.pushChoice(func(cp *choicePoint) (*environment, bool, error) {
+		for len(rules) > 0 {
+			s.restore(cp)
+			rule := rules[0]
+			rules = rules[1:]
+			cp.done = len(rules) == 0
+			body, ok, err := rule.Unify(s, goal)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				s.enter(ind)
+				return s.wake(env.push(body, cutBarrier, s.depth)), true, nil
+			}
 		}
+		cp.done = true
+		return nil, false, nil
+	})
+	return nil, false, nil
+}
+
+// profileFrame is a predicate call in the stack of calls still executing. Frames are
+// shared by choice points, so that backtracking restores the calls that were executing.
+type profileFrame struct {
+	ind    Indicator
+	depth  int
+	height int
+	parent *profileFrame
+}
+
+func (f *profileFrame) len() int {
+	if f == nil {
+		return 0
 	}
-	s.db.Logger.Log(kif.DEBUG, kif.KV{"msg", "backtrack"}, kif.KV{"depth", s.depth})
-	return nil
+	return f.height
+}
+
+// enter pushes a frame for the predicate call being resolved, if profiling.
+func (s *solver) enter(ind Indicator) {
+	if s.db.CPUProfiler == nil {
+		return
+	}
+	s.frame = &profileFrame{ind: ind, depth: s.depth, height: s.frame.len() + 1, parent: s.frame}
+	s.profile()
+}
+
+// profile exits the calls in the CPU profiler that are no longer executing, and enters the
+// new ones, so that its stack matches the current frames.
+func (s *solver) profile() {
+	p := s.db.CPUProfiler
+	if p == nil || s.profiled == s.frame {
+		return
+	}
+	var entered []*profileFrame
+	old, cur := s.profiled, s.frame
+	for old.len() > cur.len() {
+		p.Exit()
+		old = old.parent
+	}
+	for cur.len() > old.len() {
+		entered = append(entered, cur)
+		cur = cur.parent
+	}
+	for old != cur {
+		p.Exit()
+		entered = append(entered, cur)
+		old, cur = old.parent, cur.parent
+	}
+	for _, f := range slices.Backward(entered) {
+		p.Enter(profiler.Location{f.ind.String(), 1})
+	}
+	s.profiled = s.frame
+}
+
+type trailKind int
+
+const (
+	// A ref binding.
+	trailBind trailKind = iota
+	// A struct argument modified with SetArg.
+	trailArg
+	// The attributes of a ref modified with PutAttr or DelAttr.
+	trailAttrs
+	// A global variable modified with SetGlobal.
+	trailGlobal
+)
+
+// trailEntry records a change to be undone on backtracking.
+type trailEntry struct {
+	kind  trailKind
+	ref   *Ref
+	args  []Term
+	i     int
+	old   Term
+	attrs []attribute
+	name  Atom
 }
 
 func (s *solver) Unwind() func() bool {
-	n := len(s.trail)
+	n, m := len(s.trail), len(s.wakeups)
 	return func() bool {
-		if len(s.trail) == n {
-			return false
-		}
-		for _, ref := range s.trail[n:] {
-			ref.Value = nil
+		return s.undo(n, m)
+	}
+}
+
+// undo reverts the trail and the pending wakeups to the given lengths, returning whether
+// any change was undone.
+func (s *solver) undo(n, m int) bool {
+	if len(s.wakeups) > m {
+		s.wakeups = s.wakeups[:m]
+	}
+	if len(s.trail) <= n {
+		return false
+	}
+	for i := len(s.trail) - 1; i >= n; i-- {
+		e := s.trail[i]
+		switch e.kind {
+		case trailBind:
+			e.ref.Value = nil
+		case trailArg:
+			e.args[e.i] = e.old
+		case trailAttrs:
+			e.ref.attrs = e.attrs
+		case trailGlobal:
+			if e.old == nil {
+				delete(s.globals, e.name)
+			} else {
+				s.globals[e.name] = e.old
+			}
 		}
-		s.trail = s.trail[:n]
-		return true
 	}
+	clear(s.trail[n:])
+	s.trail = s.trail[:n]
+	return true
+}
+
+// SetArg destructively replaces the n-th argument of t (1-based), restoring it on backtracking.
+func (s *solver) SetArg(t Struct, n int, value Term) {
+	s.trail = append(s.trail, trailEntry{kind: trailArg, args: t.Args, i: n - 1, old: t.Args[n-1]})
+	t.Args[n-1] = value
 }
 
+// Unify unifies both terms, performing the occurs check only if enabled by the "occurs_check" option.
 func (s *solver) Unify(t1, t2 Term) bool {
+	return s.unify(t1, t2, s.occursCheck)
+}
+
+// UnifyWithOccursCheck unifies both terms, failing if a ref would be bound to a term containing it.
+func (s *solver) UnifyWithOccursCheck(t1, t2 Term) bool {
+	return s.unify(t1, t2, true)
+}
+
+func (s *solver) unify(t1, t2 Term, occursCheck bool) bool {
 	t1, t2 = Deref(t1), Deref(t2)
 	s.db.Logger.Log(kif.DEBUG-1, kif.KV{"msg", "unify"}, kif.KV{"t1", t1}, kif.KV{"t2", t2})
 	s1, isStruct1 := t1.(Struct)
@@ -473,7 +1420,7 @@ func (s *solver) Unify(t1, t2 Term) bool {
 			return false
 		}
 		for i := 0; i < len(s1.Args); i++ {
-			if !s.Unify(s1.Args[i], s2.Args[i]) {
+			if !s.unify(s1.Args[i], s2.Args[i], occursCheck) {
 				return false
 			}
 		}
@@ -482,11 +1429,32 @@ func (s *solver) Unify(t1, t2 Term) bool {
 	if t1 == t2 {
 		return true
 	}
+	ref1, isRef1 := t1.(*Ref)
+	ref2, isRef2 := t2.(*Ref)
+	if isRef1 && isRef2 && len(ref1.attrs) > 0 && len(ref2.attrs) == 0 {
+		// Prefer binding the plain ref, so that no goals are woken.
+		t1, t2 = t2, t1
+	}
 	if ref1, ok := t1.(*Ref); ok {
-		return s.bind(ref1, t2)
+		return !(occursCheck && occurs(ref1, t2)) && s.bind(ref1, t2)
 	}
 	if ref2, ok := t2.(*Ref); ok {
-		return s.bind(ref2, t1)
+		return !(occursCheck && occurs(ref2, t1)) && s.bind(ref2, t1)
+	}
+	return false
+}
+
+// occurs returns whether ref appears within t.
+func occurs(ref *Ref, t Term) bool {
+	switch t := Deref(t).(type) {
+	case *Ref:
+		return t == ref
+	case Struct:
+		for _, arg := range t.Args {
+			if occurs(ref, arg) {
+				return true
+			}
+		}
 	}
 	return false
 }
@@ -494,36 +1462,37 @@ func (s *solver) Unify(t1, t2 Term) bool {
 func (s *solver) bind(ref *Ref, t Term) bool {
 	s.db.Logger.Log(kif.DEBUG-2, kif.KV{"msg", "bind"}, kif.KV{"ref", ref}, kif.KV{"t", t})
 	ref.Value = t
-	s.trail = append(s.trail, ref)
+	s.trail = append(s.trail, trailEntry{kind: trailBind, ref: ref})
+	for _, attr := range ref.attrs {
+		s.wakeups = append(s.wakeups, attr.wakeup(t))
+	}
 	return true
 }
 
 // --- Replace vars with refs ---
 
-func varToRef(x any, env map[Var]*Ref) any {
+func varToRef(x any, env map[Var]*Ref, newRef func(Var) *Ref) any {
 	switch v := x.(type) {
 	case Clause:
 		y := make(Clause, len(v))
 		for i, goal := range v {
-			y[i] = varToRef(goal, env).(Goal)
+			y[i] = varToRef(goal, env, newRef).(Goal)
 		}
 		return y
 	case Goal:
-		return Goal{varToRef(v.Term, env).(Struct), v.LexerState}
+		return Goal{varToRef(v.Term, env, newRef).(Struct), v.LexerState}
 	case Struct:
 		y := Struct{v.Name, make([]Term, len(v.Args))}
 		for i, arg := range v.Args {
-			y.Args[i] = varToRef(arg, env).(Term)
+			y.Args[i] = varToRef(arg, env, newRef).(Term)
 		}
 		return y
 	case Var:
 		if v == "_" {
-			refID++
-			return &Ref{v, refID, nil}
+			return newRef(v)
 		}
 		if _, ok := env[v]; !ok {
-			refID++
-			env[v] = &Ref{v, refID, nil}
+			env[v] = newRef(v)
 		}
 		return env[v]
 	default:
@@ -538,6 +1507,8 @@ const (
 )
 
 func (db *Database) String() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	var b strings.Builder
 	var cnt int
 	for _, ind := range db.indicators {
@@ -1,13 +1,27 @@
 package prol_test
 
 import (
+	"compress/gzip"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
 	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/brunokim/prol-go/kif"
+	"github.com/brunokim/prol-go/profiler"
 	"github.com/brunokim/prol-go/prol"
+	profilepb "github.com/brunokim/prol-go/proto/profile"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -35,6 +49,63 @@ var (
 		clause(s("complete_me", s(".", v("X"), v("L0")), v("L")),
 			s("atom", v("X")),
 			s("complete_me", v("L0"), v("L"))),
+		// max(X, Y, X) :- >=(X, Y), !.
+		// max(_, Y, Y).
+		clause(s("max", v("X"), v("Y"), v("X")),
+			s(">=", v("X"), v("Y")),
+			s("!")),
+		clause(s("max", v("_"), v("Y"), v("Y"))),
+		// first(Elem, List) :- member(Elem, List), !.
+		clause(s("first", v("Elem"), v("List")),
+			s("member", v("Elem"), v("List")),
+			s("!")),
+		// parent(tom, bob). parent(tom, liz). parent(bob, ann). parent(bob, pat).
+		clause(s("parent", a("tom"), a("bob"))),
+		clause(s("parent", a("tom"), a("liz"))),
+		clause(s("parent", a("bob"), a("ann"))),
+		clause(s("parent", a("bob"), a("pat"))),
+		// by_length(Order, A, B) :- atom_length(A, LA), atom_length(B, LB), compare(Order, LA, LB).
+		clause(s("by_length", v("Order"), v("A"), v("B")),
+			s("atom_length", v("A"), v("LA")),
+			s("atom_length", v("B"), v("LB")),
+			s("compare", v("Order"), v("LA"), v("LB"))),
+		// reversed(Order, A, B) :- compare(Order, A, B).
+		// reversed(Order, A, B) :- flag(reversed, N, N+1), compare(Order, B, A).
+		clause(s("reversed", v("Order"), v("A"), v("B")),
+			s("compare", v("Order"), v("A"), v("B"))),
+		clause(s("reversed", v("Order"), v("A"), v("B")),
+			s("flag", a("reversed"), v("N"), s("+", v("N"), int_(1))),
+			s("compare", v("Order"), v("B"), v("A"))),
+		// greeting --> [hello, world].
+		dcg(s("greeting"), fromList(a("hello"), a("world")).(prol.Struct)),
+		// attr_unify_hook(allowed(L), X) :- member(X, L).
+		clause(s("attr_unify_hook", s("allowed", v("L")), v("X")),
+			s("member", v("X"), v("L"))),
+		// even:attr_unify_hook(_, X) :- 0 =:= X mod 2.
+		clause(s(":", a("even"), s("attr_unify_hook", v("_"), v("X"))),
+			s("=:=", int_(0), s("mod", v("X"), int_(2)))),
+		// edge(a, b). edge(b, c). edge(c, a). edge(c, d).
+		clause(s("edge", a("a"), a("b"))),
+		clause(s("edge", a("b"), a("c"))),
+		clause(s("edge", a("c"), a("a"))),
+		clause(s("edge", a("c"), a("d"))),
+		// path(X, Y) :- path(X, Z), edge(Z, Y).
+		// path(X, Y) :- edge(X, Y).
+		clause(s("path", v("X"), v("Y")),
+			s("path", v("X"), v("Z")),
+			s("edge", v("Z"), v("Y"))),
+		clause(s("path", v("X"), v("Y")),
+			s("edge", v("X"), v("Y"))),
+		// reach(X, Y) :- edge(X, Y).
+		// reach(X, Y) :- step(X, Z), reach(Z, Y).
+		// step(X, Y) :- reach(X, Y).
+		clause(s("reach", v("X"), v("Y")),
+			s("edge", v("X"), v("Y"))),
+		clause(s("reach", v("X"), v("Y")),
+			s("step", v("X"), v("Z")),
+			s("reach", v("Z"), v("Y"))),
+		clause(s("step", v("X"), v("Y")),
+			s("reach", v("X"), v("Y"))),
 	}
 )
 
@@ -42,7 +113,7 @@ func TestSolve(t *testing.T) {
 	tests := []struct {
 		name  string
 		query prol.Clause
-		opts  []any
+		opts  []prol.SolveOption
 		want  []prol.Solution
 	}{
 		{
@@ -54,7 +125,7 @@ func TestSolve(t *testing.T) {
 		{
 			"First 5 natural numbers",
 			clause(s("query"), s("nat", v("X"))),
-			[]any{"limit", 5},
+			[]prol.SolveOption{prol.WithLimit(5)},
 			[]prol.Solution{
 				{"X": a("0")},
 				{"X": s("s", a("0"))},
@@ -86,7 +157,7 @@ func TestSolve(t *testing.T) {
 			"First 3 lists with 'a'",
 			clause(s("query"),
 				s("member", a("a"), v("List"))),
-			[]any{"limit", 3},
+			[]prol.SolveOption{prol.WithLimit(3)},
 			[]prol.Solution{
 				{"List": s(".", a("a"), ref("T"))},
 				{"List": s(".", ref("H"), s(".", a("a"), ref("T")))},
@@ -133,25 +204,982 @@ func TestSolve(t *testing.T) {
 				)},
 			},
 		},
+		{
+			"DCG reflection",
+			clause(s("query"),
+				s("get_predicate", s("indicator", a("greeting"), int_(2)), fromList(v("C"))),
+				s("put_predicate", s("indicator", a("greeting"), int_(2)), fromList(v("C"))),
+				s("greeting", v("L"), a("[]"))),
+			nil,
+			[]prol.Solution{
+				{
+					"C": s("dcg",
+						s("struct", a("greeting"), prol.Nil),
+						fromList(s("struct", a("."), fromList(
+							s("atom", a("hello")),
+							s("struct", a("."), fromList(s("atom", a("world")), s("atom", a("[]")))))))),
+					"L": fromList(a("hello"), a("world")),
+				},
+			},
+		},
 		{
 			"Database manipulation",
 			clause(s("query"),
-				s("get_predicate", s("indicator", a("complete_me"), int_(2)), fromList(v("_C1"))),
-				s("put_predicate", s("indicator", a("complete_me"), int_(2)), fromList(
-					s("clause",
-						s("struct", a("complete_me"),
-							fromList(
-								s("var", a("L")),
-								s("var", a("L")))),
-						prol.Nil),
-					v("_C1"))),
-				s("complete_me", fromList(a("1"), a("10"), a("100"), int_(1000)), v("Rest"))),
+				s("get_predicate", s("indicator", a("complete_me"), int_(2)), fromList(v("_C1"))),
+				s("put_predicate", s("indicator", a("complete_me"), int_(2)), fromList(
+					s("clause",
+						s("struct", a("complete_me"),
+							fromList(
+								s("var", a("L")),
+								s("var", a("L")))),
+						prol.Nil),
+					v("_C1"))),
+				s("complete_me", fromList(a("1"), a("10"), a("100"), int_(1000)), v("Rest"))),
+			nil,
+			[]prol.Solution{
+				{"Rest": fromList(a("1"), a("10"), a("100"), int_(1000))},
+				{"Rest": fromList(a("10"), a("100"), int_(1000))},
+				{"Rest": fromList(a("100"), int_(1000))},
+				{"Rest": fromList(int_(1000))},
+			},
+		},
+		{
+			"Cut commits to clause",
+			clause(s("query"),
+				s("max", int_(3), int_(2), v("X")),
+				s("max", int_(1), int_(2), v("Y"))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(3), "Y": int_(2)},
+			},
+		},
+		{
+			"Cut prunes goals before it",
+			clause(s("query"),
+				s("member", v("X"), fromList(a("a"), a("b"))),
+				s("first", v("Y"), fromList(a("c"), a("d")))),
+			nil,
+			[]prol.Solution{
+				{"X": a("a"), "Y": a("c")},
+				{"X": a("b"), "Y": a("c")},
+			},
+		},
+		{
+			"Cut in query",
+			clause(s("query"),
+				s("member", v("X"), fromList(a("a"), a("b"))),
+				s("!"),
+				s("member", v("Y"), fromList(a("c"), a("d")))),
+			nil,
+			[]prol.Solution{
+				{"X": a("a"), "Y": a("c")},
+				{"X": a("a"), "Y": a("d")},
+			},
+		},
+		{
+			"Disjunction",
+			clause(s("query"),
+				s(";", s("=", v("X"), a("a")), s("=", v("X"), a("b")))),
+			nil,
+			[]prol.Solution{
+				{"X": a("a")},
+				{"X": a("b")},
+			},
+		},
+		{
+			"If-then-else",
+			clause(s("query"),
+				s(";",
+					s("->",
+						s(",", s("member", v("X"), fromList(int_(1), int_(2), int_(3))), s(">=", v("X"), int_(2))),
+						s("=", v("Y"), a("then"))),
+					s("=", v("Y"), a("else")))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(2), "Y": a("then")},
+			},
+		},
+		{
+			"If-then-else with failing condition",
+			clause(s("query"),
+				s(";",
+					s("->", s(",", s("!"), s("fail")), s("=", v("X"), a("then"))),
+					s("=", v("X"), a("else")))),
+			nil,
+			[]prol.Solution{
+				{"X": a("else")},
+			},
+		},
+		{
+			"If-then without else",
+			clause(s("query"),
+				s("member", v("X"), fromList(int_(1), int_(2), int_(3))),
+				s("->", s(">=", v("X"), int_(2)), s("true"))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(2)},
+				{"X": int_(3)},
+			},
+		},
+		{
+			"Soft-cut",
+			clause(s("query"),
+				s(";",
+					s("*->", s("member", v("X"), fromList(int_(1), int_(2))), s("=", v("Y"), a("then"))),
+					s("=", v("Y"), a("else")))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(1), "Y": a("then")},
+				{"X": int_(2), "Y": a("then")},
+			},
+		},
+		{
+			"Soft-cut with failing condition",
+			clause(s("query"),
+				s(";",
+					s("*->", s("member", v("X"), prol.Nil), s("=", v("Y"), a("then"))),
+					s("=", v("Y"), a("else")))),
+			nil,
+			[]prol.Solution{
+				{"X": ref("X"), "Y": a("else")},
+			},
+		},
+		{
+			"Negation",
+			clause(s("query"),
+				s("member", v("X"), fromList(int_(1), int_(2), int_(3))),
+				s("\\+", s("member", v("X"), fromList(int_(2), int_(4))))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(1)},
+				{"X": int_(3)},
+			},
+		},
+		{
+			"Cut is transparent in disjunction",
+			clause(s("query"),
+				s("member", v("X"), fromList(int_(1), int_(2), int_(3))),
+				s(";", s(",", s(">=", v("X"), int_(2)), s("!")), s("fail"))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(2)},
+			},
+		},
+		{
+			"Cut is local to call",
+			clause(s("query"),
+				s("member", v("X"), fromList(int_(1), int_(2), int_(3))),
+				s("call", s(",", s("!"), s(">=", v("X"), int_(2))))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(2)},
+				{"X": int_(3)},
+			},
+		},
+		{
+			"Call with extra args",
+			clause(s("query"),
+				s("call", s("parent", a("tom")), v("X")),
+				s("call", a("parent"), v("Y"), a("ann"))),
+			nil,
+			[]prol.Solution{
+				{"X": a("bob"), "Y": a("bob")},
+				{"X": a("liz"), "Y": a("bob")},
+			},
+		},
+		{
+			"Findall",
+			clause(s("query"),
+				s("findall", v("X"), s("parent", a("tom"), v("X")), v("L1")),
+				s("findall", v("X"), s("parent", a("liz"), v("X")), v("L2"))),
+			nil,
+			[]prol.Solution{
+				{"X": ref("X"), "L1": fromList(a("bob"), a("liz")), "L2": prol.Nil},
+			},
+		},
+		{
+			"Bagof groups by free variables",
+			clause(s("query"),
+				s("bagof", v("C"), s("parent", v("P"), v("C")), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"C": ref("C"), "P": a("tom"), "L": fromList(a("bob"), a("liz"))},
+				{"C": ref("C"), "P": a("bob"), "L": fromList(a("ann"), a("pat"))},
+			},
+		},
+		{
+			"Bagof with existential variable",
+			clause(s("query"),
+				s("bagof", v("C"), s("^", v("P"), s("parent", v("P"), v("C"))), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"C": ref("C"), "P": ref("P"), "L": fromList(a("bob"), a("liz"), a("ann"), a("pat"))},
+			},
+		},
+		{
+			"Bagof fails without solutions",
+			clause(s("query"),
+				s("bagof", v("C"), s("parent", a("liz"), v("C")), v("L"))),
+			nil,
+			nil,
+		},
+		{
+			"Setof",
+			clause(s("query"),
+				s("setof", v("P"), s("^", v("C"), s("parent", v("P"), v("C"))), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"C": ref("C"), "P": ref("P"), "L": fromList(a("bob"), a("tom"))},
+			},
+		},
+		{
+			"Forall",
+			clause(s("query"),
+				s("forall", s("parent", a("tom"), v("C")), s("atom", v("C"))),
+				s("\\+", s("forall", s("parent", v("P"), v("C")), s("=", v("P"), a("tom"))))),
+			nil,
+			[]prol.Solution{
+				{"C": ref("C"), "P": ref("P")},
+			},
+		},
+		{
+			"Catch thrown ball",
+			clause(s("query"),
+				s("catch",
+					s(",", s("=", v("X"), a("bound")), s("throw", s("ball", v("X")))),
+					s("ball", v("Y")),
+					s("true"))),
+			nil,
+			[]prol.Solution{
+				{"X": ref("X"), "Y": a("bound")},
+			},
+		},
+		{
+			"Catch builtin error",
+			clause(s("query"),
+				s("catch",
+					s(">", a("a"), int_(1)),
+					s("error", v("Err"), v("_")),
+					s("true"))),
+			nil,
+			[]prol.Solution{
+				{"Err": s("type_error", a("evaluable"), s("/", a("a"), int_(0)))},
+			},
+		},
+		{
+			"Catch with non-matching catcher",
+			clause(s("query"),
+				s("catch",
+					s("catch", s("throw", a("inner")), a("other"), s("fail")),
+					v("Ball"),
+					s("true"))),
+			nil,
+			[]prol.Solution{
+				{"Ball": a("inner")},
+			},
+		},
+		{
+			"Catch goal with multiple solutions",
+			clause(s("query"),
+				s("catch", s("member", v("X"), fromList(int_(1), int_(2))), v("_"), s("true")),
+				s("catch", s("is", v("Y"), s("+", v("X"), int_(1))), v("_"), s("fail"))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(1), "Y": int_(2)},
+				{"X": int_(2), "Y": int_(3)},
+			},
+		},
+		{
+			"Arithmetic comparison",
+			clause(s("query"),
+				s("member", v("X"), fromList(int_(1), int_(2), int_(3), int_(4))),
+				s("=:=", s("mod", v("X"), int_(2)), int_(0)),
+				s("=\\=", v("X"), s("*", int_(2), int_(2)))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(2)},
+			},
+		},
+		{
+			"Big integers",
+			clause(s("query"),
+				s("is", v("X"), s("**", int_(2), int_(64))),
+				s(">", v("X"), a("max_integer")),
+				s("int_to_chars", v("X"), v("_Chars")),
+				s("chars_to_int", v("_Chars"), v("Y")),
+				s("=", v("X"), v("Y"))),
+			nil,
+			[]prol.Solution{
+				{
+					"X": prol.BigInt("18446744073709551616"),
+					"Y": prol.BigInt("18446744073709551616"),
+				},
+			},
+		},
+		{
+			"Floats",
+			clause(s("query"),
+				s("member", v("X"), fromList(int_(1), float_(2.5), a("a"), float_(1))),
+				s("number", v("X")),
+				s("=:=", v("X"), int_(1)),
+				s("is", v("Y"), s("/", v("X"), int_(2)))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(1), "Y": float_(0.5)},
+				{"X": float_(1), "Y": float_(0.5)},
+			},
+		},
+		{
+			"Compare",
+			clause(s("query"),
+				s("compare", v("O1"), int_(1), a("a")),
+				s("compare", v("O2"), s("f", a("b")), s("f", a("a"))),
+				s("compare", v("O3"), float_(1), int_(1)),
+				s("==", s("f", v("X")), s("f", v("X"))),
+				s("\\==", v("X"), v("Y")),
+				s("@<", v("X"), int_(1)),
+				s("@<", s("g", a("a")), s("f", a("a"), a("b")))),
+			nil,
+			[]prol.Solution{
+				{"O1": a("<"), "O2": a(">"), "O3": a("<"), "X": ref("X"), "Y": ref("Y")},
+			},
+		},
+		{
+			"Identity doesn't bind",
+			clause(s("query"), s("==", v("X"), int_(1))),
+			nil,
+			nil,
+		},
+		{
+			"Identity and unifiability",
+			clause(s("query"),
+				s("\\==", v("_X"), v("_Y")),
+				s("\\+", s("neq", v("_X"), v("_Y"))),
+				s("\\=", s("f", v("_X")), s("g", v("_X"))),
+				s("\\+", s("\\=", s("f", v("_X")), s("f", a("a")))),
+				s("var", v("_X")),
+				s("=", v("_C1"), s("f", v("_C1"))),
+				s("=", v("_C2"), s("f", v("_C2"))),
+				s("==", v("_C1"), v("_C2"))),
+			nil,
+			[]prol.Solution{{}},
+		},
+		{
+			"Sort in standard order",
+			clause(s("query"),
+				s("msort", fromList(a("b"), int_(1), s("f", a("x")), float_(1), a("a"), int_(1)), v("L1")),
+				s("sort", fromList(a("b"), int_(1), s("f", a("x")), float_(1), a("a"), int_(1)), v("L2"))),
+			nil,
+			[]prol.Solution{
+				{
+					"L1": fromList(float_(1), int_(1), int_(1), a("a"), a("b"), s("f", a("x"))),
+					"L2": fromList(float_(1), int_(1), a("a"), a("b"), s("f", a("x"))),
+				},
+			},
+		},
+		{
+			"Keysort is stable",
+			clause(s("query"),
+				s("keysort", fromList(s("-", a("b"), int_(1)), s("-", a("a"), int_(2)), s("-", a("b"), int_(0))), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"L": fromList(s("-", a("a"), int_(2)), s("-", a("b"), int_(1)), s("-", a("b"), int_(0)))},
+			},
+		},
+		{
+			"Predsort removes equal elements",
+			clause(s("query"),
+				s("predsort", a("by_length"), fromList(a("ccc"), a("a"), a("bb"), a("d")), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"L": fromList(a("a"), a("bb"), a("ccc"))},
+			},
+		},
+		{
+			"Predsort uses the first solution of the comparison",
+			clause(s("query"),
+				s("predsort", a("reversed"), fromList(int_(2), int_(3), int_(1)), v("L")),
+				s("flag", a("reversed"), v("N"), v("N"))),
+			nil,
+			[]prol.Solution{
+				{"L": fromList(int_(1), int_(2), int_(3)), "N": int_(0)},
+			},
+		},
+		{
+			"Functor",
+			clause(s("query"),
+				s("functor", s("f", a("a"), a("b")), v("N1"), v("A1")),
+				s("functor", v("T"), a("g"), int_(2)),
+				s("=", v("T"), s("g", a("x"), a("y"))),
+				s("functor", a("c"), v("N2"), v("A2"))),
+			nil,
+			[]prol.Solution{
+				{"N1": a("f"), "A1": int_(2), "T": s("g", a("x"), a("y")), "N2": a("c"), "A2": int_(0)},
+			},
+		},
+		{
+			"Arg enumerates arguments",
+			clause(s("query"), s("arg", v("N"), s("f", a("a"), a("b")), v("X"))),
+			nil,
+			[]prol.Solution{
+				{"N": int_(1), "X": a("a")},
+				{"N": int_(2), "X": a("b")},
+			},
+		},
+		{
+			"Univ",
+			clause(s("query"),
+				s("=..", s("f", a("a"), a("b")), v("L")),
+				s("=..", v("T"), fromList(a("g"), a("x"))),
+				s("=..", v("A"), fromList(a("c")))),
+			nil,
+			[]prol.Solution{
+				{"L": fromList(a("f"), a("a"), a("b")), "T": s("g", a("x")), "A": a("c")},
+			},
+		},
+		{
+			"Copy term",
+			clause(s("query"),
+				s("copy_term", s("f", v("_X"), v("_Y"), v("_X")), v("C")),
+				s("=", v("C"), s("f", int_(1), int_(2), v("Z"))),
+				s("var", v("_X"))),
+			nil,
+			[]prol.Solution{
+				{"C": s("f", int_(1), int_(2), int_(1)), "Z": int_(1)},
+			},
+		},
+		{
+			"Term variables",
+			clause(s("query"),
+				s("term_variables", s("f", v("_X"), s("g", v("_Y"), v("_X")), a("a")), v("_L")),
+				s("=", v("_L"), fromList(int_(1), int_(2))),
+				s("=", v("R"), s("f", v("_X"), v("_Y")))),
+			nil,
+			[]prol.Solution{
+				{"R": s("f", int_(1), int_(2))},
+			},
+		},
+		{
+			"Setarg is undone on backtracking",
+			clause(s("query"),
+				s("=", v("T1"), s("f", a("a"))),
+				s(";", s(",", s("setarg", int_(1), v("T1"), a("b")), s("fail")), s("true")),
+				s("=", v("T2"), s("f", a("a"))),
+				s("setarg", int_(1), v("T2"), a("c"))),
+			nil,
+			[]prol.Solution{
+				{"T1": s("f", a("a")), "T2": s("f", a("c"))},
+			},
+		},
+		{
+			"Nb_setarg survives backtracking",
+			clause(s("query"),
+				s("=", v("T"), s("f", a("a"))),
+				s(";", s(",", s("nb_setarg", int_(1), v("T"), a("b")), s("fail")), s("true"))),
+			nil,
+			[]prol.Solution{
+				{"T": s("f", a("b"))},
+			},
+		},
+		{
+			"Retract on backtracking",
+			clause(s("query"),
+				s("retract", s("parent", a("bob"), v("X"))),
+				s("findall", v("_Y"), s("parent", a("bob"), v("_Y")), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"X": a("ann"), "L": fromList(a("pat"))},
+				{"X": a("pat"), "L": fromList()},
+			},
+		},
+		{
+			"Retract rule with body",
+			clause(s("query"),
+				s("retract", s(":-", s("first", v("_"), v("_")), s(",", s("member", v("_"), v("_")), a("!")))),
+				s("\\+", s("first", a("a"), fromList(a("a"))))),
+			nil,
+			[]prol.Solution{{}},
+		},
+		{
+			"Assert and retract clause terms",
+			clause(s("query"),
+				s("asserta", s(":-", s("p_dyn", v("_X")), s("parent", v("_X"), v("_")))),
+				s("assertz", s("p_dyn", a("zed"))),
+				s("findall", v("_Y"), s("p_dyn", v("_Y")), v("L0")),
+				s("retract", s(":-", s("p_dyn", v("_Z")), s("parent", v("_Z"), v("_")))),
+				s("findall", v("_W"), s("p_dyn", v("_W")), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"L0": fromList(a("tom"), a("tom"), a("bob"), a("bob"), a("zed")), "L": fromList(a("zed"))},
+			},
+		},
+		{
+			"Logical update view",
+			clause(s("query"),
+				s("findall", v("_X"),
+					s(",", s("parent", a("tom"), v("_X")),
+						s(",", s("asserta", s("clause", s("struct", a("parent"), fromList(s("atom", a("tom")), s("atom", a("zed")))), fromList())),
+							s("retract", s("parent", a("tom"), a("liz"))))),
+					v("L0")),
+				s("findall", v("_Y"), s("parent", a("tom"), v("_Y")), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"L0": fromList(a("bob")), "L": fromList(a("zed"), a("zed"), a("bob"))},
+			},
+		},
+		{
+			"Retractall",
+			clause(s("query"),
+				s("retractall", s("parent", v("_"), a("pat"))),
+				s("retractall", s("undefined", v("_"))),
+				s("\\+", s("undefined", v("_"))),
+				s("findall", v("_Y"), s("parent", a("bob"), v("_Y")), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"L": fromList(a("ann"))},
+			},
+		},
+		{
+			"Abolish",
+			clause(s("query"),
+				s("abolish", s("/", a("parent"), int_(2))),
+				s("catch", s("parent", v("_"), v("_")), s("error", s("existence_error", a("procedure"), v("PI")), v("_")), a("true"))),
+			nil,
+			[]prol.Solution{
+				{"PI": s("/", a("parent"), int_(2))},
+			},
+		},
+		{
+			"Clause facts",
+			clause(s("query"), s("clause", s("parent", a("tom"), v("X")), a("true"))),
+			nil,
+			[]prol.Solution{
+				{"X": a("bob")},
+				{"X": a("liz")},
+			},
+		},
+		{
+			"Clause body",
+			clause(s("query"), s("clause", s("add", s("s", a("a")), a("b"), v("C")), v("B"))),
+			nil,
+			[]prol.Solution{
+				{"C": s("s", ref("Z")), "B": s("add", a("a"), a("b"), ref("Z"))},
+			},
+		},
+		{
+			"Clause follows the logical update view",
+			clause(s("query"),
+				s("assertz", s("r", int_(1))),
+				s("assertz", s("r", int_(2))),
+				s("findall", v("_X"), s(",", s("clause", s("r", v("_X")), a("true")), s("assertz", s("r", int_(3)))), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"L": fromList(int_(1), int_(2))},
+			},
+		},
+		{
+			"Current predicate",
+			clause(s("query"),
+				s("current_predicate", s("/", a("parent"), v("N"))),
+				s("\\+", s("current_predicate", s("/", a("atom_length"), v("_"))))),
+			nil,
+			[]prol.Solution{
+				{"N": int_(2)},
+			},
+		},
+		{
+			"Current predicate in module",
+			clause(s("query"),
+				s(":", a("m2"), s("assertz", s("q", int_(1)))),
+				s("current_predicate", s(":", a("m2"), s("/", a("q"), v("N")))),
+				s("\\+", s("current_predicate", s("/", a("q"), v("_")))),
+				s("findall", v("_P"), s(":", a("m2"), s("current_predicate", v("_P"))), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"N": int_(1), "L": fromList(s("/", a("q"), int_(1)))},
+			},
+		},
+		{
+			"Predicate properties",
+			clause(s("query"), s("predicate_property", s("parent", v("_"), v("_")), v("P"))),
+			nil,
+			[]prol.Solution{
+				{"P": a("defined")},
+				{"P": a("static")},
+				{"P": s("number_of_clauses", int_(4))},
+			},
+		},
+		{
+			"Dynamic predicate properties",
+			clause(s("query"),
+				s("dynamic", s("/", a("declared"), int_(1))),
+				s("predicate_property", s("declared", v("_")), a("dynamic")),
+				s("assertz", s("asserted", int_(1))),
+				s("predicate_property", s("asserted", v("_")), a("dynamic")),
+				s("\\+", s("predicate_property", s("parent", v("_"), v("_")), a("dynamic")))),
+			nil,
+			[]prol.Solution{{}},
+		},
+		{
+			"Builtin predicate properties",
+			clause(s("query"),
+				s("predicate_property", s("atom_length", v("_"), v("_")), a("built_in")),
+				s("predicate_property", a("!"), a("static")),
+				s("\\+", s("predicate_property", s("undefined", v("_")), v("_")))),
+			nil,
+			[]prol.Solution{{}},
+		},
+		{
+			"Global variables",
+			clause(s("query"),
+				s("b_setval", a("v"), a("a")),
+				s(";", s(",", s("b_setval", a("v"), a("b")), s("fail")), s("true")),
+				s("b_getval", a("v"), v("B")),
+				s(";", s(",", s("nb_setval", a("w"), s("f", v("_X"))), s(",", s("=", v("_X"), int_(1)), s("fail"))), s("true")),
+				s("nb_getval", a("w"), v("W"))),
+			nil,
+			[]prol.Solution{
+				{"B": a("a"), "W": s("f", ref("_X"))},
+			},
+		},
+		{
+			"Flag counter",
+			clause(s("query"),
+				s(";", s(",", s("flag", a("n"), v("_N"), s("+", v("_N"), int_(1))), s("fail")), s("true")),
+				s("flag", a("n"), v("N0"), s("*", v("N0"), int_(10))),
+				s("flag", a("n"), v("N"), v("N"))),
+			nil,
+			[]prol.Solution{
+				{"N0": int_(1), "N": int_(10)},
+			},
+		},
+		{
+			"Succ",
+			clause(s("query"),
+				s("succ", int_(3), v("X")),
+				s("succ", v("Y"), int_(3)),
+				s("\\+", s("succ", v("_"), int_(0)))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(4), "Y": int_(2)},
+			},
+		},
+		{
+			"Unify with occurs check",
+			clause(s("query"),
+				s("unify_with_occurs_check", s("f", v("X"), a("a")), s("f", a("b"), v("Y"))),
+				s("\\+", s("unify_with_occurs_check", v("_Z"), s("f", v("_Z"))))),
+			nil,
+			[]prol.Solution{
+				{"X": a("b"), "Y": a("a")},
+			},
+		},
+		{
+			"Occurs check option",
+			clause(s("query"),
+				s("current_prolog_flag", a("occurs_check"), v("Flag")),
+				s(";", s("->", s("=", v("_X"), s("f", v("_X"))), s("=", v("R"), a("cyclic"))), s("=", v("R"), a("fail")))),
+			[]prol.SolveOption{prol.WithOccursCheck(true)},
+			[]prol.Solution{
+				{"Flag": a("true"), "R": a("fail")},
+			},
+		},
+		{
+			"Cyclic terms",
+			clause(s("query"),
+				s("=", v("X"), s("f", v("X"))),
+				s("cyclic_term", v("X")),
+				s("acyclic_term", s("f", v("_Y"), v("_Y"))),
+				s("=", v("_L"), s(".", a("a"), v("_L"))),
+				s("catch", s("msort", v("_L"), v("_")), s("error", s("type_error", v("Type"), v("_")), v("_")), s("true"))),
+			nil,
+			[]prol.Solution{
+				{"X": s("@", v("_S1"), fromList(s("=", v("_S1"), s("f", v("_S1"))))), "Type": a("list")},
+			},
+		},
+		{
+			"Attributes are undone on backtracking",
+			clause(s("query"),
+				s("put_attr", v("_X"), a("m"), a("v1")),
+				s("get_attr", v("_X"), a("m"), v("V1")),
+				s(";", s(",", s("put_attr", v("_X"), a("m"), a("v2")), s("fail")), s("true")),
+				s("get_attr", v("_X"), a("m"), v("V2")),
+				s("del_attr", v("_X"), a("m")),
+				s("\\+", s("get_attr", v("_X"), a("m"), v("_")))),
+			nil,
+			[]prol.Solution{
+				{"V1": a("v1"), "V2": a("v1")},
+			},
+		},
+		{
+			"Attribute unify hook",
+			clause(s("query"),
+				s("put_attr", v("X"), a("domain"), s("allowed", fromList(a("a"), a("b")))),
+				s(";", s("=", v("X"), a("c")), s("=", v("X"), a("b")))),
+			nil,
+			[]prol.Solution{
+				{"X": a("b")},
+			},
+		},
+		{
+			"Attribute unify hook by module",
+			clause(s("query"),
+				s("put_attr", v("X"), a("domain"), s("allowed", fromList(int_(1), int_(2), int_(3)))),
+				s("put_attr", v("X"), a("even"), a("true")),
+				s("member", v("X"), fromList(int_(1), int_(2), int_(3)))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(2)},
+			},
+		},
+		{
+			"Freeze delays goal",
+			clause(s("query"),
+				s("freeze", v("_X"), s("=", v("Y"), a("done"))),
+				s(";", s("->", s("var", v("Y")), s("=", v("A"), a("waiting"))), s("=", v("A"), a("early"))),
+				s("=", v("_X"), int_(1))),
+			nil,
+			[]prol.Solution{
+				{"Y": a("done"), "A": a("waiting")},
+			},
+		},
+		{
+			"Freeze on aliased refs",
+			clause(s("query"),
+				s("freeze", v("_X"), s("=", v("R1"), a("x"))),
+				s("freeze", v("_Y"), s("=", v("R2"), a("y"))),
+				s("=", v("_X"), v("_Y")),
+				s(";", s("->", s("var", v("R1")), s("=", v("A"), a("none"))), s("=", v("A"), a("some"))),
+				s("=", v("_Y"), int_(1))),
+			nil,
+			[]prol.Solution{
+				{"R1": a("x"), "R2": a("y"), "A": a("none")},
+			},
+		},
+		{
+			"Dif is checked on binding",
+			clause(s("query"),
+				s("dif", v("X"), v("Y")),
+				s("=", v("X"), a("a")),
+				s("\\+", s("=", v("Y"), a("a"))),
+				s("=", v("Y"), a("b")),
+				s("dif", s("f", v("_A"), v("_B")), s("f", int_(1), int_(2))),
+				s("=", v("_A"), int_(1)),
+				s("\\+", s("=", v("_B"), int_(2)))),
+			nil,
+			[]prol.Solution{
+				{"X": a("a"), "Y": a("b")},
+			},
+		},
+		{
+			"Dif fails on aliasing",
+			clause(s("query"),
+				s("dif", v("_A"), v("_B")),
+				s("=", v("_A"), v("_B"))),
+			nil,
+			nil,
+		},
+		{
+			"When executes goal once",
+			clause(s("query"),
+				s("=", v("C"), s("c", int_(0))),
+				s("when", s(";", s("nonvar", v("_P")), s("nonvar", v("_Q"))), s(",",
+					s("arg", int_(1), v("C"), v("_N")),
+					s(",", s("is", v("_N1"), s("+", v("_N"), int_(1))), s("nb_setarg", int_(1), v("C"), v("_N1"))))),
+				s("when", s("ground", s("f", v("_P"), v("_Q"))), s("=", v("R"), a("ground"))),
+				s("=", v("_P"), int_(1)),
+				s(";", s("->", s("var", v("R")), s("=", v("A"), a("partial"))), s("=", v("A"), a("early"))),
+				s("=", v("_Q"), int_(2))),
+			nil,
+			[]prol.Solution{
+				{"C": s("c", int_(1)), "R": a("ground"), "A": a("partial")},
+			},
+		},
+		{
+			"CLP(FD) propagation",
+			clause(s("query"),
+				s("in", v("_X"), s("..", int_(1), int_(10))),
+				s("#>", v("_X"), int_(7)),
+				s("#\\=", v("_X"), int_(9)),
+				s("fd_dom", v("_X"), v("D")),
+				s("#=", v("Y"), s("+", int_(3), s("*", int_(2), int_(2)))),
+				s("#=", s("*", int_(2), v("Z")), s("+", v("Y"), int_(1)))),
+			nil,
+			[]prol.Solution{
+				{"D": s("\\/", int_(8), int_(10)), "Y": int_(7), "Z": int_(4)},
+			},
+		},
+		{
+			"CLP(FD) binding outside domain",
+			clause(s("query"),
+				s("in", v("X"), s("..", int_(1), int_(3))),
+				s("\\+", s("=", v("X"), int_(4))),
+				s("=", v("X"), int_(2))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(2)},
+			},
+		},
+		{
+			"CLP(FD) all different",
+			clause(s("query"),
+				s("ins", fromList(v("X"), v("Y"), v("Z")), s("..", int_(1), int_(3))),
+				s("all_different", fromList(v("X"), v("Y"), v("Z"))),
+				s("#<", v("X"), v("Y")),
+				s("label", fromList(v("X"), v("Y"), v("Z")))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(1), "Y": int_(2), "Z": int_(3)},
+				{"X": int_(1), "Y": int_(3), "Z": int_(2)},
+				{"X": int_(2), "Y": int_(3), "Z": int_(1)},
+			},
+		},
+		{
+			"CLP(FD) sum",
+			clause(s("query"),
+				s("ins", fromList(v("A"), v("B")), s("..", int_(0), int_(5))),
+				s("sum", fromList(v("A"), v("B")), a("#="), int_(9)),
+				s("labeling", fromList(a("ff")), fromList(v("A"), v("B")))),
+			nil,
+			[]prol.Solution{
+				{"A": int_(4), "B": int_(5)},
+				{"A": int_(5), "B": int_(4)},
+			},
+		},
+		{
+			"CLP(FD) product",
+			clause(s("query"),
+				s("#=", s("*", v("X"), v("Y")), int_(6)),
+				s("ins", fromList(v("X"), v("Y")), s("..", int_(1), int_(6))),
+				s("#=<", v("X"), v("Y")),
+				s("label", fromList(v("X"), v("Y")))),
+			nil,
+			[]prol.Solution{
+				{"X": int_(1), "Y": int_(6)},
+				{"X": int_(2), "Y": int_(3)},
+			},
+		},
+		{
+			"Tabled left recursion",
+			clause(s("query"),
+				s("table", s("/", a("path"), int_(2))),
+				s("path", a("a"), v("Y"))),
+			nil,
+			[]prol.Solution{
+				{"Y": a("b")},
+				{"Y": a("c")},
+				{"Y": a("a")},
+				{"Y": a("d")},
+			},
+		},
+		{
+			"Tabled open call",
+			clause(s("query"),
+				s("table", s("/", a("path"), int_(2))),
+				s("path", v("X"), a("d"))),
+			nil,
+			[]prol.Solution{
+				{"X": a("b")},
+				{"X": a("a")},
+				{"X": a("c")},
+			},
+		},
+		{
+			"Tabled mutual recursion",
+			clause(s("query"),
+				s("table", fromList(s("/", a("reach"), int_(2)), s("/", a("step"), int_(2)))),
+				s("\\+", s("reach", a("d"), v("_"))),
+				s("reach", a("b"), v("Y"))),
 			nil,
 			[]prol.Solution{
-				{"Rest": fromList(a("1"), a("10"), a("100"), int_(1000))},
-				{"Rest": fromList(a("10"), a("100"), int_(1000))},
-				{"Rest": fromList(a("100"), int_(1000))},
-				{"Rest": fromList(int_(1000))},
+				{"Y": a("c")},
+				{"Y": a("a")},
+				{"Y": a("d")},
+				{"Y": a("b")},
+			},
+		},
+		{
+			"Tabled call with cut",
+			clause(s("query"),
+				s("table", s("/", a("path"), int_(2))),
+				s("path", a("a"), v("Y")),
+				s("!")),
+			nil,
+			[]prol.Solution{
+				{"Y": a("b")},
+			},
+		},
+		{
+			"Dynamic predicate without clauses",
+			clause(s("query"),
+				s("dynamic", s("/", a("undefined"), int_(1))),
+				s(";", s("undefined", v("X")), s("=", v("X"), a("none")))),
+			nil,
+			[]prol.Solution{
+				{"X": a("none")},
+			},
+		},
+		{
+			"Call qualified with user module",
+			clause(s("query"), s(":", a("user"), s("parent", a("tom"), v("X")))),
+			nil,
+			[]prol.Solution{
+				{"X": a("bob")},
+				{"X": a("liz")},
+			},
+		},
+		{
+			"Meta-call qualified with module",
+			clause(s("query"),
+				s("module", a("m"), a("[]")),
+				s("dynamic", s("/", a("p"), int_(1))),
+				s("module", a("user"), a("[]")),
+				s("findall", v("_X"), s(":", a("m"), s(";", s("p", v("_X")), s("=", v("_X"), a("none")))), v("L"))),
+			nil,
+			[]prol.Solution{
+				{"L": fromList(a("none"))},
+			},
+		},
+		{
+			"Assert, call and retract within module",
+			clause(s("query"),
+				s(":", a("m2"), s("assertz", s("q", int_(1)))),
+				s(":", a("m2"), s("asserta", s(":-", s("q", int_(2)), a("true")))),
+				s("findall", v("_X"), s(":", a("m2"), s("q", v("_X"))), v("L0")),
+				s(":", a("m2"), s("retract", s("q", int_(1)))),
+				s("findall", v("_Y"), s(":", a("m2"), s("q", v("_Y"))), v("L")),
+				s("\\+", s("catch", s("q", v("_")), v("_"), a("fail"))),
+				s(":", a("m2"), s("dynamic", s("/", a("r"), int_(1)))),
+				s("\\+", s(":", a("m2"), s("r", v("_")))),
+				s(":", a("m2"), s("abolish", s("/", a("r"), int_(1)))),
+				s("catch", s(":", a("m2"), s("r", v("_"))), s("error", s("existence_error", a("procedure"), v("PI")), v("_")), a("true"))),
+			nil,
+			[]prol.Solution{
+				{"L0": fromList(int_(2), int_(1)), "L": fromList(int_(2)), "PI": s(":", a("m2"), s("/", a("r"), int_(1)))},
+			},
+		},
+		{
+			"Unknown flag set to fail",
+			clause(s("query"),
+				s("set_prolog_flag", a("unknown"), a("fail")),
+				s(";", s("undefined", v("X")), s("=", v("X"), a("none"))),
+				s("current_prolog_flag", a("unknown"), v("Flag"))),
+			nil,
+			[]prol.Solution{
+				{"X": a("none"), "Flag": a("fail")},
+			},
+		},
+		{
+			"Unknown flag per module",
+			clause(s("query"),
+				s(":", a("m2"), s("set_prolog_flag", a("unknown"), a("fail"))),
+				s("\\+", s(":", a("m2"), s("undefined", v("_")))),
+				s("catch", s("undefined", v("_")), s("error", s("existence_error", a("procedure"), v("PI")), v("_")), a("true")),
+				s(":", a("m2"), s("current_prolog_flag", a("unknown"), v("Flag1"))),
+				s("current_prolog_flag", a("unknown"), v("Flag2"))),
+			nil,
+			[]prol.Solution{
+				{"PI": s("/", a("undefined"), int_(1)), "Flag1": a("fail"), "Flag2": a("error")},
 			},
 		},
 	}
@@ -159,7 +1187,7 @@ func TestSolve(t *testing.T) {
 
 	opts := cmp.Options{
 		cmp.AllowUnexported(prol.Ref{}),
-		cmpopts.IgnoreFields(prol.Ref{}, "id"),
+		cmpopts.IgnoreFields(prol.Ref{}, "src", "id"),
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -178,3 +1206,630 @@ func TestSolve(t *testing.T) {
 		})
 	}
 }
+
+func TestSolveErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query prol.Clause
+		want  prol.Term
+	}{
+		{
+			"Throw",
+			clause(s("query"), s("throw", s("ball", int_(1)))),
+			s("ball", int_(1)),
+		},
+		{
+			"Type error",
+			clause(s("query"), s("atom_length", int_(10), v("_"))),
+			s("error", s("type_error", a("atom"), int_(10)), s("context", s("/", a("atom_length"), int_(2)), ref("_"))),
+		},
+		{
+			"Instantiation error",
+			clause(s("query"), s("is", v("X"), s("+", v("Y"), int_(1)))),
+			s("error", a("instantiation_error"), s("context", s("/", a("is"), int_(2)), ref("_"))),
+		},
+		{
+			"Unknown procedure",
+			clause(s("query"), s("undefined", int_(1))),
+			s("error", s("existence_error", a("procedure"), s("/", a("undefined"), int_(1))), s("context", s("/", a("undefined"), int_(1)), ref("_"))),
+		},
+		{
+			"Unknown procedure in module",
+			clause(s("query"), s(":", a("m"), s("undefined", int_(1)))),
+			s("error", s("existence_error", a("procedure"), s(":", a("m"), s("/", a("undefined"), int_(1)))), s("context", s(":", a("m"), s("/", a("undefined"), int_(1))), ref("_"))),
+		},
+		{
+			"Invalid flag value",
+			clause(s("query"), s("set_prolog_flag", a("unknown"), a("ignore"))),
+			s("error", s("domain_error", a("flag_value"), s("+", a("unknown"), a("ignore"))), s("context", s("/", a("set_prolog_flag"), int_(2)), ref("_"))),
+		},
+		{
+			"Sort partial list",
+			clause(s("query"), s("sort", s(".", int_(1), v("T")), v("_"))),
+			s("error", a("instantiation_error"), s("context", s("/", a("sort"), int_(2)), ref("_"))),
+		},
+		{
+			"Keysort non-pair",
+			clause(s("query"), s("keysort", fromList(a("a")), v("_"))),
+			s("error", s("type_error", a("pair"), a("a")), s("context", s("/", a("keysort"), int_(2)), ref("_"))),
+		},
+		{
+			"Functor with unbound name",
+			clause(s("query"), s("functor", v("_T"), v("_N"), int_(2))),
+			s("error", a("instantiation_error"), s("context", s("/", a("functor"), int_(3)), ref("_"))),
+		},
+		{
+			"Arg with non-integer index",
+			clause(s("query"), s("arg", a("a"), s("f", a("x")), v("_"))),
+			s("error", s("type_error", a("integer"), a("a")), s("context", s("/", a("arg"), int_(3)), ref("_"))),
+		},
+		{
+			"Univ with empty list",
+			clause(s("query"), s("=..", v("_T"), a("[]"))),
+			s("error", s("domain_error", a("non_empty_list"), a("[]")), s("context", s("/", a("=.."), int_(2)), ref("_"))),
+		},
+		{
+			"Put attribute on non-var",
+			clause(s("query"), s("put_attr", a("a"), a("m"), a("v"))),
+			s("error", s("uninstantiation_error", a("a")), s("context", s("/", a("put_attr"), int_(3)), ref("_"))),
+		},
+		{
+			"Invalid when condition",
+			clause(s("query"), s("when", s("foo", v("_")), s("true"))),
+			s("error", s("domain_error", a("when_condition"), s("foo", ref("_"))), s("context", s("/", a("when"), int_(2)), ref("_"))),
+		},
+		{
+			"CLP(FD) invalid domain",
+			clause(s("query"), s("in", v("_X"), a("a"))),
+			s("error", s("type_error", a("clpfd_domain"), a("a")), s("context", s("/", a("in"), int_(2)), ref("_"))),
+		},
+		{
+			"CLP(FD) coefficient overflow",
+			clause(s("query"), s("#=", v("_X"), s("*", int_(4611686018427387904), s("*", int_(2), v("_Y"))))),
+			s("error", s("representation_error", a("max_integer")), s("context", s("/", a("#="), int_(2)), ref("_"))),
+		},
+		{
+			"CLP(FD) foreign attribute",
+			clause(s("query"), s("put_attr", v("X"), a("clpfd"), a("foo")), s("#>", v("X"), int_(1))),
+			s("error", s("type_error", a("clpfd_attribute"), a("foo")), s("context", s("/", a("#>"), int_(2)), ref("_"))),
+		},
+		{
+			"CLP(FD) propagation limit",
+			clause(s("query"),
+				s("in", v("X"), s("..", int_(0), int_(1000000))),
+				s("in", v("Y"), s("..", int_(0), int_(1000000))),
+				s("#>", v("X"), v("Y")),
+				s("#>", v("Y"), v("X"))),
+			s("error", s("resource_error", a("clpfd_propagation")), s("context", s("/", a("#>"), int_(2)), ref("_"))),
+		},
+		{
+			"CLP(FD) foreign attribute on binding",
+			clause(s("query"), s("put_attr", v("X"), a("clpfd"), s("$fd", fromList(a("foo")), a("[]"))), s("=", v("X"), int_(1))),
+			s("error", s("type_error", a("clpfd_attribute"), s("$fd", fromList(a("foo")), a("[]"))), s("context", s("/", a("clpfd"), int_(0)), ref("_"))),
+		},
+		{
+			"CLP(FD) label unbounded",
+			clause(s("query"), s("#>", v("_X"), int_(0)), s("label", fromList(v("_X")))),
+			s("error", a("instantiation_error"), s("context", s("/", a("labeling"), int_(2)), ref("_"))),
+		},
+		{
+			"Retract static procedure",
+			clause(s("query"), s("retract", s("atom_length", v("_"), v("_")))),
+			s("error", s("permission_error", a("modify"), a("static_procedure"), s("/", a("atom_length"), int_(2))), s("context", s("/", a("retract"), int_(1)), ref("_"))),
+		},
+		{
+			"Assertz static procedure",
+			clause(s("query"), s("assertz", s("atom_length", a("a"), int_(1)))),
+			s("error", s("permission_error", a("modify"), a("static_procedure"), s("/", a("atom_length"), int_(2))), s("context", s("/", a("assertz"), int_(1)), ref("_"))),
+		},
+		{
+			"Asserta static procedure",
+			clause(s("query"), s("asserta", s(":-", s("atom_length", a("a"), int_(1)), a("true")))),
+			s("error", s("permission_error", a("modify"), a("static_procedure"), s("/", a("atom_length"), int_(2))), s("context", s("/", a("asserta"), int_(1)), ref("_"))),
+		},
+		{
+			"Abolish invalid indicator",
+			clause(s("query"), s("abolish", a("foo"))),
+			s("error", s("type_error", a("predicate_indicator"), a("foo")), s("context", s("/", a("abolish"), int_(1)), ref("_"))),
+		},
+		{
+			"Clause of static procedure",
+			clause(s("query"), s("clause", s("atom_length", v("_"), v("_")), v("_"))),
+			s("error", s("permission_error", a("access"), a("private_procedure"), s("/", a("atom_length"), int_(2))), s("context", s("/", a("clause"), int_(2)), ref("_"))),
+		},
+		{
+			"Clause unbound head",
+			clause(s("query"), s("clause", v("_"), a("true"))),
+			s("error", a("instantiation_error"), s("context", s("/", a("clause"), int_(2)), ref("_"))),
+		},
+		{
+			"Current predicate invalid indicator",
+			clause(s("query"), s("current_predicate", a("foo"))),
+			s("error", s("type_error", a("predicate_indicator"), a("foo")), s("context", s("/", a("current_predicate"), int_(1)), ref("_"))),
+		},
+		{
+			"Global variable does not exist",
+			clause(s("query"), s("b_getval", a("undefined"), v("_"))),
+			s("error", s("existence_error", a("variable"), a("undefined")), s("context", s("/", a("b_getval"), int_(2)), ref("_"))),
+		},
+		{
+			"Succ of negative integer",
+			clause(s("query"), s("succ", v("_"), int_(-1))),
+			s("error", s("type_error", a("not_less_than_zero"), int_(-1)), s("context", s("/", a("succ"), int_(2)), ref("_"))),
+		},
+		{
+			"Error not caught in continuation",
+			clause(s("query"),
+				s("catch", s("true"), v("_"), s("true")),
+				s("throw", a("after"))),
+			a("after"),
+		},
+		{
+			"Error in recovery",
+			clause(s("query"),
+				s("catch", s("throw", a("first")), v("_"), s("throw", a("second")))),
+			a("second"),
+		},
+	}
+	opts := cmp.Options{
+		cmp.AllowUnexported(prol.Ref{}),
+		cmpopts.IgnoreFields(prol.Ref{}, "src", "id"),
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := prol.NewDatabase(rules...)
+			seq, ferr := db.Solve(test.query)
+			for range seq {
+			}
+			var err *prol.PrologError
+			if !errors.As(ferr(), &err) {
+				t.Fatalf("want PrologError, got %v", ferr())
+			}
+			if diff := cmp.Diff(test.want, err.Term, opts...); diff != "" {
+				t.Errorf("(-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestConcurrentSolve(t *testing.T) {
+	db, err := prol.Prelude()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 16
+	var wg sync.WaitGroup
+	// Writers assert and retract facts while readers query them.
+	const m = 128
+	db.Dynamic(prol.Indicator{Name: "test_dyn", Arity: 1})
+	for i := range m {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			db.Assert(clause(s("test_dyn", int_(i))))
+			seq, errFn := db.Solve(clause(s("query"), s("retract", s("test_dyn", int_(i)))))
+			if got := len(slices.Collect(seq)); got != 1 {
+				t.Errorf("writer %d: got %d retracted facts, want 1", i, got)
+			}
+			if err := errFn(); err != nil {
+				t.Errorf("writer %d: got err: %v", i, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			seq, errFn := db.Solve(clause(s("query"), s("findall", v("X"), s("test_dyn", v("X")), v("_L")), s("msort", v("_L"), v("_"))))
+			if got := len(slices.Collect(seq)); got != 1 {
+				t.Errorf("reader %d: got %d solutions, want 1", i, got)
+			}
+			if err := errFn(); err != nil {
+				t.Errorf("reader %d: got err: %v", i, err)
+			}
+		}()
+	}
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := db.Interpret(fmt.Sprintf("test_fact(%d).", i)); err != nil {
+				t.Errorf("goroutine %d: interpret err: %v", i, err)
+				return
+			}
+			query, err := db.Query("flag(test_calls, N, +(N, 1)), atom_length(abc, L).")
+			if err != nil {
+				t.Errorf("goroutine %d: query err: %v", i, err)
+				return
+			}
+			solution, err := db.FirstSolution(query.(prol.Clause))
+			if err != nil {
+				t.Errorf("goroutine %d: solve err: %v", i, err)
+				return
+			}
+			if got := solution["L"]; got != int_(3) {
+				t.Errorf("goroutine %d: got L = %v, want 3", i, got)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := db.Counter("test_calls"); got != int_(n) {
+		t.Errorf("got %v calls, want %d", got, n)
+	}
+	seq, errFn := db.Solve(clause(s("query"), s("test_fact", v("X"))))
+	if got := len(slices.Collect(seq)); got != n {
+		t.Errorf("got %d facts, want %d", got, n)
+	}
+	if err := errFn(); err != nil {
+		t.Errorf("got err: %v", err)
+	}
+	seq, _ = db.Solve(clause(s("query"), s("test_dyn", v("X"))))
+	if got := slices.Collect(seq); len(got) > 0 {
+		t.Errorf("got facts left after retract: %v", got)
+	}
+}
+
+func TestConcurrentInterpret(t *testing.T) {
+	db, err := prol.Prelude()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 16
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			text := fmt.Sprintf(":- module(test_mod%d, [p/1]).\np(%d).", i, i)
+			if err := db.Interpret(text); err != nil {
+				t.Errorf("goroutine %d: interpret err: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range n {
+		query, err := db.Query(fmt.Sprintf("findall(X, test_mod%d:p(X), L).", i))
+		if err != nil {
+			t.Fatalf("query err: %v", err)
+		}
+		solution, err := db.FirstSolution(query.(prol.Clause))
+		if err != nil {
+			t.Fatalf("solve err: %v", err)
+		}
+		if got, want := solution["L"], fromList(int_(i)); !cmp.Equal(got, want) {
+			t.Errorf("test_mod%d: got %v, want %v", i, got, want)
+		}
+	}
+	if db.PredicateExists(prol.Indicator{Name: "p", Arity: 1}) {
+		t.Errorf("p/1 asserted into the user module")
+	}
+}
+
+func TestFork(t *testing.T) {
+	// query(). f(X). f(a). f(b).
+	base := prol.NewDatabase(
+		clause(s("query")),
+		clause(s("f", v("X"))),
+		clause(s("f", a("a"))),
+		clause(s("f", a("b"))))
+	base.Logger = kif.NewLogger(nopWriteCloser{io.Discard})
+	fork := base.Fork()
+	if fork.Logger != base.Logger {
+		t.Errorf("fork doesn't share logger")
+	}
+	fork.Assert(clause(s("f", a("c"))))
+	base.Assert(clause(s("f", a("d"))))
+	fork.Assert(clause(s("g", a("e"))))
+	tests := []struct {
+		name  string
+		db    *prol.Database
+		query prol.Clause
+		want  []prol.Solution
+	}{
+		{
+			"Base indexed",
+			base,
+			clause(s("query"), s("f", a("c"))),
+			[]prol.Solution{{}},
+		},
+		{
+			"Base all",
+			base,
+			clause(s("query"), s("f", v("X"))),
+			[]prol.Solution{{"X": ref("X")}, {"X": a("a")}, {"X": a("b")}, {"X": a("d")}},
+		},
+		{
+			"Fork indexed",
+			fork,
+			clause(s("query"), s("f", a("d"))),
+			[]prol.Solution{{}},
+		},
+		{
+			"Fork all",
+			fork,
+			clause(s("query"), s("f", v("X"))),
+			[]prol.Solution{{"X": ref("X")}, {"X": a("a")}, {"X": a("b")}, {"X": a("c")}},
+		},
+		{
+			"Fork new predicate",
+			fork,
+			clause(s("query"), s("g", v("X"))),
+			[]prol.Solution{{"X": a("e")}},
+		},
+	}
+	opts := cmp.Options{
+		cmp.AllowUnexported(prol.Ref{}),
+		cmpopts.IgnoreFields(prol.Ref{}, "src", "id"),
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			seq, errFn := test.db.Solve(test.query)
+			got := slices.Collect(seq)
+			if err := errFn(); err != nil {
+				t.Errorf("got err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, opts...); diff != "" {
+				t.Errorf("(-want, +got): %s", diff)
+			}
+		})
+	}
+	if base.PredicateExists(prol.Indicator{Name: "g", Arity: 1}) {
+		t.Errorf("predicate asserted in fork exists in base")
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestSolveBudget(t *testing.T) {
+	// Enumerates natural numbers forever.
+	query := clause(s("query"), s("nat", v("_X")), s("fail"))
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		opts []prol.SolveOption
+		want error
+	}{
+		{"Max inferences", context.Background(), []prol.SolveOption{prol.WithMaxInferences(100)}, prol.MaxInferencesError{Inferences: 100}},
+		{"Canceled context", canceled, nil, context.Canceled},
+		{"Context timeout", timeout, nil, context.DeadlineExceeded},
+	}
+	db := prol.NewDatabase(rules...)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			seq, errFn := db.SolveContext(test.ctx, query, test.opts...)
+			if got := slices.Collect(seq); len(got) > 0 {
+				t.Errorf("got solutions: %v", got)
+			}
+			if err := errFn(); !errors.Is(err, test.want) {
+				t.Errorf("got err %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestConsultError(t *testing.T) {
+	db, err := prol.Prelude()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "throw.pl")
+	if err := os.WriteFile(path, []byte("p(1).\n:- throw(ball(1)).\np(2).\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The exception thrown by the directive is returned, instead of a syntax error.
+	query := clause(s("query"), s("catch", s("consult", a(path)), v("E"), a("true")))
+	got, err := db.FirstSolution(query)
+	if err != nil {
+		t.Fatalf("got err: %v", err)
+	}
+	if diff := cmp.Diff(prol.Solution{v("E"): s("ball", int_(1))}, got); diff != "" {
+		t.Errorf("(-want, +got):\n%s", diff)
+	}
+}
+
+func TestSortRefs(t *testing.T) {
+	// The context var of the error is created by the builtin, with an id from the package's
+	// counter. Create enough refs within the solver so that their ids would overlap.
+	for range 100 {
+		ref("_")
+	}
+	var id int
+	fmt.Sscanf(ref("_").String(), "_@%d", &id)
+	n := id + 100
+	db := prol.NewDatabase(clause(s("query")))
+	query := clause(s("query"),
+		s("functor", v("_T"), a("f"), int_(n)),
+		s("catch", s("atom_length", v("_"), v("_")), s("error", v("_"), s("context", v("_"), v("_V"))), a("true")),
+		s("=..", v("_T"), s(".", v("_"), v("_Args"))),
+		s("sort", s(".", v("_V"), v("_Args")), v("Sorted")))
+	solution, err := db.FirstSolution(query)
+	if err != nil {
+		t.Fatalf("got err: %v", err)
+	}
+	terms, _ := toList(solution[v("Sorted")])
+	if got := len(terms); got != n+1 {
+		t.Errorf("got %d sorted refs, want %d", got, n+1)
+	}
+}
+
+func TestUnknownDefault(t *testing.T) {
+	db := prol.NewDatabase(rules...)
+	db.SetUnknown(prol.UnknownFail)
+	db.SetModuleUnknown("m2", prol.UnknownError)
+	seq, errFn := db.Solve(clause(s("query"), s("undefined")))
+	if got := slices.Collect(seq); len(got) > 0 {
+		t.Errorf("got solutions in user module: %v", got)
+	}
+	if err := errFn(); err != nil {
+		t.Errorf("got err in user module: %v", err)
+	}
+	seq, errFn = db.Solve(clause(s("query"), s(":", a("m2"), s("undefined"))))
+	if got := slices.Collect(seq); len(got) > 0 {
+		t.Errorf("got solutions in module m2: %v", got)
+	}
+	if err := errFn(); err == nil || !strings.Contains(err.Error(), "existence_error") {
+		t.Errorf("want existence error in module m2, got err: %v", err)
+	}
+	if got := db.ModuleUnknown("m3"); got != prol.UnknownFail {
+		t.Errorf("got unknown flag %v in module m3, want %v", got, prol.UnknownFail)
+	}
+}
+
+func TestCompareRefsFromDifferentQueries(t *testing.T) {
+	// Each query allocates ids from its own solver, so both refs have the same id.
+	db := prol.NewDatabase(clause(s("query")))
+	query := clause(s("query"), s("=", v("X"), v("_")))
+	sol1, err := db.FirstSolution(query)
+	if err != nil {
+		t.Fatalf("got err: %v", err)
+	}
+	sol2, err := db.FirstSolution(query)
+	if err != nil {
+		t.Fatalf("got err: %v", err)
+	}
+	x1, x2 := sol1[v("X")], sol2[v("X")]
+	if c := prol.Compare(x1, x2); c == 0 {
+		t.Errorf("Compare(%v, %v) = 0 for distinct refs", x1, x2)
+	}
+}
+
+func TestDeepRecursion(t *testing.T) {
+	// With a small Go stack, recursing once per goal would crash the test.
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 18))
+	db := prol.NewDatabase(
+		clause(s("numlist", v("N"), v("N"), a("[]")), s("!")),
+		clause(s("numlist", v("I"), v("N"), s(".", v("I"), v("T"))),
+			s("is", v("I1"), s("+", v("I"), int_(1))),
+			s("numlist", v("I1"), v("N"), v("T"))),
+		clause(s("len", a("[]"), v("N"), v("N"))),
+		clause(s("len", s(".", v("_"), v("T")), v("N0"), v("N")),
+			s("is", v("N1"), s("+", v("N0"), int_(1))),
+			s("len", v("T"), v("N1"), v("N"))),
+		clause(s("query")),
+	)
+	const n = 100000
+	query := clause(s("query"), s("numlist", int_(0), int_(n), v("_L")), s("len", v("_L"), int_(0), v("N")))
+	solution, err := db.FirstSolution(query)
+	if err != nil {
+		t.Fatalf("got err: %v", err)
+	}
+	if got := solution[v("N")]; got != int_(n) {
+		t.Errorf("got N = %v, want %d", got, n)
+	}
+}
+
+func TestSolveOptions(t *testing.T) {
+	db := prol.NewDatabase(rules...)
+	query := clause(s("query"), s("nat", v("X")))
+	t.Run("Invalid option", func(t *testing.T) {
+		seq, errFn := db.Solve(query, prol.WithLimit(-1))
+		if got := slices.Collect(seq); len(got) > 0 {
+			t.Errorf("got solutions: %v", got)
+		}
+		if err := errFn(); err == nil {
+			t.Errorf("want error for negative limit")
+		}
+	})
+	t.Run("Invalid prelude option", func(t *testing.T) {
+		if _, err := prol.Prelude(prol.WithMaxDepth(-1)); err == nil {
+			t.Errorf("want error for negative max depth")
+		}
+		if _, err := prol.Bootstrap2(prol.WithMaxDepth(-1)); err == nil {
+			t.Errorf("want error for negative max depth in Bootstrap2")
+		}
+	})
+	t.Run("Options struct", func(t *testing.T) {
+		// The struct resets all options set before it, so the max depth is not applied.
+		seq, errFn := db.Solve(query, prol.WithMaxDepth(1), prol.SolveOptions{Limit: 2})
+		if got := len(slices.Collect(seq)); got != 2 {
+			t.Errorf("got %d solutions, want 2", got)
+		}
+		if err := errFn(); err != nil && !errors.Is(err, (prol.MaxSolutionsError{})) {
+			t.Errorf("got err: %v", err)
+		}
+	})
+	t.Run("Caller options are not modified", func(t *testing.T) {
+		opts := make([]prol.SolveOption, 1, 2)
+		opts[0] = prol.WithLimit(1)
+		seq, _ := db.SolveContext(context.Background(), query, opts...)
+		for range seq {
+		}
+		// The database has no parser, so interpreting fails after adding its own options.
+		_ = db.Interpret("", opts...)
+		if extra := opts[:2][1]; extra != nil {
+			t.Errorf("caller's options slice was modified: %v", extra)
+		}
+	})
+	t.Run("Trace", func(t *testing.T) {
+		var b strings.Builder
+		seq, _ := db.Solve(query, prol.WithLimit(3), prol.WithTrace(&b))
+		for range seq {
+		}
+		// Goals in the query are at the same depth, and each recursive call is one level deeper.
+		if got, want := b.String(), "query()\nnat(X@1)\n  nat(X@2)\n    nat(X@3)\n"; got != want {
+			t.Errorf("got trace %q, want %q", got, want)
+		}
+	})
+}
+
+// profileStacks returns the stacks of the samples in a profile file, from the root call.
+func profileStacks(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p profilepb.Profile
+	if err := proto.Unmarshal(bs, &p); err != nil {
+		t.Fatal(err)
+	}
+	var stacks []string
+	for _, sample := range p.GetSample() {
+		var names []string
+		for _, id := range slices.Backward(sample.GetLocationId()) {
+			fn := p.GetFunction()[p.GetLocation()[id-1].GetLine()[0].GetFunctionId()-1]
+			names = append(names, p.GetStringTable()[fn.GetName()])
+		}
+		stacks = append(stacks, strings.Join(names, ";"))
+	}
+	return stacks
+}
+
+func TestCPUProfiler(t *testing.T) {
+	db := prol.NewDatabase(
+		// query().
+		clause(s("query")),
+		// p :- q(X), r(X).
+		clause(s("p"), s("q", v("X")), s("r", v("X"))),
+		// q(1). q(2).
+		clause(s("q", int_(1))),
+		clause(s("q", int_(2))),
+		// r(2).
+		clause(s("r", int_(2))))
+	db.CPUProfiler = profiler.NewCPUProfiler()
+	if _, err := db.FirstSolution(clause(s("query"), s("p"))); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cpu.prof")
+	if err := db.CPUProfiler.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// Each call is sampled when it exits, or is backtracked past.
+	want := []string{"query/0", "p/0;q/1", "p/0;q/1", "p/0;r/1", "p/0"}
+	if diff := cmp.Diff(want, profileStacks(t, path)); diff != "" {
+		t.Errorf("(-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,96 @@
+package prol
+
+import (
+	"fmt"
+)
+
+// --- Exceptions ---
+
+// PrologError is an exception raised by throw/1, or by a builtin, that wasn't caught by catch/3.
+type PrologError struct {
+	Term Term
+}
+
+func (err *PrologError) Error() string {
+	return fmt.Sprintf("uncaught exception: %v", RefToTerm(err.Term))
+}
+
+// --- ISO error terms ---
+
+// indicatorTerm represents an indicator as the term 'Name/Arity', or 'Module:Name/Arity'
+// outside of the user module.
+func indicatorTerm(ind Indicator) Term {
+	return qualify(ind.Module, Struct{"/", []Term{ind.Name, Int(ind.Arity)}})
+}
+
+// isoError creates an exception with a term like 'error(Formal, context(Name/Arity, _))'.
+//
+// The formal term is copied, since bindings are undone until reaching a catch goal.
+func isoError(formal Term, ind Indicator) *PrologError {
+	formal = copyTerm(formal, make(map[*Ref]*Ref), NewRef)
+	context := Struct{"context", []Term{indicatorTerm(ind), NewRef("_")}}
+	return &PrologError{Struct{"error", []Term{formal, context}}}
+}
+
+func instantiationError(ind Indicator) *PrologError {
+	return isoError(Atom("instantiation_error"), ind)
+}
+
+func typeError(typ Atom, culprit Term, ind Indicator) *PrologError {
+	return isoError(Struct{"type_error", []Term{typ, culprit}}, ind)
+}
+
+func uninstantiationError(culprit Term, ind Indicator) *PrologError {
+	return isoError(Struct{"uninstantiation_error", []Term{culprit}}, ind)
+}
+
+func domainError(domain Atom, culprit Term, ind Indicator) *PrologError {
+	return isoError(Struct{"domain_error", []Term{domain, culprit}}, ind)
+}
+
+func existenceError(kind Atom, culprit Term, ind Indicator) *PrologError {
+	return isoError(Struct{"existence_error", []Term{kind, culprit}}, ind)
+}
+
+func permissionError(action, typ Atom, culprit Term, ind Indicator) *PrologError {
+	return isoError(Struct{"permission_error", []Term{action, typ, culprit}}, ind)
+}
+
+func evaluationError(err Atom, ind Indicator) *PrologError {
+	return isoError(Struct{"evaluation_error", []Term{err}}, ind)
+}
+
+func resourceError(resource Atom, ind Indicator) *PrologError {
+	return isoError(Struct{"resource_error", []Term{resource}}, ind)
+}
+
+func representationError(flag Atom, ind Indicator) *PrologError {
+	return isoError(Struct{"representation_error", []Term{flag}}, ind)
+}
+
+func syntaxError(msg string, ind Indicator) *PrologError {
+	return isoError(Struct{"syntax_error", []Term{Atom(msg)}}, ind)
+}
+
+// withMessage sets the message in the error context, if it's an ISO error term.
+func (err *PrologError) withMessage(msg string) *PrologError {
+	t, ok := err.Term.(Struct)
+	if !ok || t.Indicator() != (Indicator{Name: "error", Arity: 2}) {
+		return err
+	}
+	context, ok := t.Args[1].(Struct)
+	if !ok || context.Indicator() != (Indicator{Name: "context", Arity: 2}) {
+		return err
+	}
+	context = Struct{"context", []Term{context.Args[0], Atom(msg)}}
+	return &PrologError{Struct{"error", []Term{t.Args[0], context}}}
+}
+
+// typeOrInstantiationError returns an instantiation error if the culprit is unbound, or a
+// type error otherwise.
+func typeOrInstantiationError(typ Atom, culprit Term, ind Indicator) *PrologError {
+	if _, ok := Deref(culprit).(*Ref); ok {
+		return instantiationError(ind)
+	}
+	return typeError(typ, culprit, ind)
+}
@@ -1,55 +1,713 @@
 package prol
 
 import (
-	"fmt"
+	"errors"
+	"math"
+	"math/big"
+	"math/bits"
 )
 
 // Eval evaluates an arithmetic expression and returns its result.
+//
+// Integer results are promoted to BigInt when they don't fit in an Int. Operations mixing
+// integers and floats convert the integers to floats.
 func Eval(term Term) (Term, error) {
+	return eval(term, Indicator{Name: "is", Arity: 2})
+}
+
+// eval evaluates an arithmetic expression, using the indicator of the calling builtin as
+// context for errors.
+func eval(term Term, ctx Indicator) (Term, error) {
 	term = Deref(term)
 	switch t := term.(type) {
 	case *Ref:
-		return nil, fmt.Errorf("nonground term")
+		return nil, instantiationError(ctx)
+	case Int, BigInt, Float:
+		return t, nil
+	case Atom:
+		if x, ok := constants[t]; ok {
+			return x, nil
+		}
+		return nil, typeError("evaluable", indicatorTerm(Indicator{Name: t, Arity: 0}), ctx)
 	case Struct:
-		args := make([]Term, len(t.Args))
-		for i, arg := range t.Args {
-			var err error
-			args[i], err = Eval(arg)
+		switch len(t.Args) {
+		case 1:
+			f, ok := unaryFunctions[t.Name]
+			if !ok {
+				break
+			}
+			x, err := eval(t.Args[0], ctx)
 			if err != nil {
-				return nil, fmt.Errorf("%v: arg #%d: %w", t.Indicator(), i+1, err)
+				return nil, err
 			}
-		}
-		switch t.Indicator() {
-		case Indicator{"-", 1}:
-			arg1, ok := Deref(args[0]).(Int)
+			return f.apply(x, ctx)
+		case 2:
+			f, ok := binaryFunctions[t.Name]
 			if !ok {
-				return nil, fmt.Errorf("-/1: want -Int, got -%T", args[0])
+				break
 			}
-			return Int(-int(arg1)), nil
-		case Indicator{"+", 1}:
-			arg1, ok := Deref(args[0]).(Int)
-			if !ok {
-				return nil, fmt.Errorf("+/1: want +Int, got +%T", args[0])
-			}
-			return Int(+int(arg1)), nil
-		case Indicator{"-", 2}:
-			arg1, ok1 := Deref(args[0]).(Int)
-			arg2, ok2 := Deref(args[1]).(Int)
-			if !ok1 || !ok2 {
-				return nil, fmt.Errorf("-/2: want Int - Int, got %T - %T", args[0], args[1])
-			}
-			return Int(int(arg1) - int(arg2)), nil
-		case Indicator{"+", 2}:
-			arg1, ok1 := Deref(args[0]).(Int)
-			arg2, ok2 := Deref(args[1]).(Int)
-			if !ok1 || !ok2 {
-				return nil, fmt.Errorf("+/2: want Int + Int, got %T + %T", args[0], args[1])
-			}
-			return Int(int(arg1) + int(arg2)), nil
-		default:
-			return nil, fmt.Errorf("unknown operator: %v", t.Indicator())
+			x, err := eval(t.Args[0], ctx)
+			if err != nil {
+				return nil, err
+			}
+			y, err := eval(t.Args[1], ctx)
+			if err != nil {
+				return nil, err
+			}
+			return f.apply(x, y, ctx)
+		}
+		return nil, typeError("evaluable", indicatorTerm(t.Indicator()), ctx)
+	default:
+		return nil, typeError("evaluable", term, ctx)
+	}
+}
+
+// isInteger returns whether the term is an Int or a BigInt.
+func isInteger(t Term) bool {
+	switch t.(type) {
+	case Int, BigInt:
+		return true
+	default:
+		return false
+	}
+}
+
+// isNumber returns whether the term is an integer or a float.
+func isNumber(t Term) bool {
+	_, ok := t.(Float)
+	return ok || isInteger(t)
+}
+
+// toBig converts an Int or BigInt into an arbitrary-precision integer.
+func toBig(t Term) *big.Int {
+	switch t := t.(type) {
+	case Int:
+		return t.Big()
+	case BigInt:
+		return t.Big()
+	default:
+		panic("not an integer: " + t.String())
+	}
+}
+
+// toFloat converts a number into a float, returning an error if it's too large.
+func toFloat(t Term, ctx Indicator) (float64, error) {
+	switch t := t.(type) {
+	case Float:
+		return float64(t), nil
+	case Int:
+		return float64(t), nil
+	case BigInt:
+		f, _ := new(big.Float).SetInt(t.Big()).Float64()
+		if math.IsInf(f, 0) {
+			return 0, evaluationError("float_overflow", ctx)
 		}
+		return f, nil
 	default:
-		return term, nil
+		panic("not a number: " + t.String())
+	}
+}
+
+// newFloat checks that a float result is finite.
+func newFloat(x float64, ctx Indicator) (Term, error) {
+	if math.IsInf(x, 0) {
+		return nil, evaluationError("float_overflow", ctx)
+	}
+	if math.IsNaN(x) {
+		return nil, evaluationError("undefined", ctx)
+	}
+	return Float(x), nil
+}
+
+// floatToInt converts a float with an integral value into an integer.
+func floatToInt(x float64, ctx Indicator) (Term, error) {
+	if math.IsInf(x, 0) || math.IsNaN(x) {
+		return nil, evaluationError("undefined", ctx)
+	}
+	if x >= math.MinInt && x < math.MaxInt {
+		return Int(x), nil
+	}
+	z, _ := new(big.Float).SetFloat64(x).Int(nil)
+	return NewInt(z), nil
+}
+
+// --- Evaluable functors ---
+
+// errIntOverflow is returned by functions on Int that need to be recomputed with big.Int.
+var errIntOverflow = errors.New("int overflow")
+
+// unaryFunction has implementations for each kind of number.
+//
+// The implementation for Ints may return errIntOverflow to retry with arbitrary precision.
+// Missing integer implementations convert their argument to float, and a missing float
+// implementation means that the function is only defined for integers.
+type unaryFunction struct {
+	small func(x Int, ctx Indicator) (Term, error)
+	big   func(x *big.Int, ctx Indicator) (Term, error)
+	float func(x float64, ctx Indicator) (Term, error)
+}
+
+func (f unaryFunction) apply(x Term, ctx Indicator) (Term, error) {
+	if x, ok := x.(Int); ok && f.small != nil {
+		z, err := f.small(x, ctx)
+		if err != errIntOverflow {
+			return z, err
+		}
+	}
+	if isInteger(x) && f.big != nil {
+		return f.big(toBig(x), ctx)
+	}
+	if f.float == nil {
+		return nil, typeError("integer", x, ctx)
+	}
+	x1, err := toFloat(x, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return f.float(x1, ctx)
+}
+
+// binaryFunction has implementations for each kind of number, like unaryFunction.
+//
+// If any of the arguments is a float, the other is converted to float as well.
+type binaryFunction struct {
+	small func(x, y Int, ctx Indicator) (Term, error)
+	big   func(x, y *big.Int, ctx Indicator) (Term, error)
+	float func(x, y float64, ctx Indicator) (Term, error)
+}
+
+func (f binaryFunction) apply(x, y Term, ctx Indicator) (Term, error) {
+	x1, ok1 := x.(Int)
+	y1, ok2 := y.(Int)
+	if ok1 && ok2 && f.small != nil {
+		z, err := f.small(x1, y1, ctx)
+		if err != errIntOverflow {
+			return z, err
+		}
+	}
+	if isInteger(x) && isInteger(y) && f.big != nil {
+		return f.big(toBig(x), toBig(y), ctx)
+	}
+	if f.float == nil {
+		if !isInteger(x) {
+			return nil, typeError("integer", x, ctx)
+		}
+		return nil, typeError("integer", y, ctx)
+	}
+	x2, err := toFloat(x, ctx)
+	if err != nil {
+		return nil, err
+	}
+	y2, err := toFloat(y, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return f.float(x2, y2, ctx)
+}
+
+var constants = map[Atom]Term{
+	"max_integer": Int(math.MaxInt),
+	"min_integer": Int(math.MinInt),
+	"pi":          Float(math.Pi),
+	"e":           Float(math.E),
+	"epsilon":     Float(math.Nextafter(1, 2) - 1),
+}
+
+// floatFunction wraps a function from math that returns a float.
+func floatFunction(f func(x float64) float64) func(x float64, ctx Indicator) (Term, error) {
+	return func(x float64, ctx Indicator) (Term, error) {
+		return newFloat(f(x), ctx)
+	}
+}
+
+// roundFunction wraps a function from math that rounds a float to an integer.
+func roundFunction(f func(x float64) float64) unaryFunction {
+	return unaryFunction{
+		small: func(x Int, ctx Indicator) (Term, error) { return x, nil },
+		big:   func(x *big.Int, ctx Indicator) (Term, error) { return NewInt(x), nil },
+		float: func(x float64, ctx Indicator) (Term, error) { return floatToInt(f(x), ctx) },
+	}
+}
+
+var unaryFunctions = map[Atom]unaryFunction{
+	"+": {
+		func(x Int, ctx Indicator) (Term, error) { return x, nil },
+		func(x *big.Int, ctx Indicator) (Term, error) { return NewInt(x), nil },
+		func(x float64, ctx Indicator) (Term, error) { return Float(x), nil },
+	},
+	"-":    {neg, bigNeg, floatFunction(func(x float64) float64 { return -x })},
+	"abs":  {abs, bigAbs, floatFunction(math.Abs)},
+	"sign": {sign, bigSign, floatSign},
+	"\\": {
+		small: func(x Int, ctx Indicator) (Term, error) { return ^x, nil },
+		big:   func(x *big.Int, ctx Indicator) (Term, error) { return NewInt(x.Not(x)), nil },
+	},
+	"msb":                   {small: msb, big: bigMsb},
+	"sqrt":                  {float: sqrt},
+	"sin":                   {float: floatFunction(math.Sin)},
+	"cos":                   {float: floatFunction(math.Cos)},
+	"tan":                   {float: floatFunction(math.Tan)},
+	"asin":                  {float: floatFunction(math.Asin)},
+	"acos":                  {float: floatFunction(math.Acos)},
+	"atan":                  {float: floatFunction(math.Atan)},
+	"exp":                   {float: floatFunction(math.Exp)},
+	"log":                   {float: logarithm},
+	"float":                 {float: floatFunction(func(x float64) float64 { return x })},
+	"float_integer_part":    {float: floatFunction(math.Trunc)},
+	"float_fractional_part": {float: floatFunction(func(x float64) float64 { return x - math.Trunc(x) })},
+	"integer":               roundFunction(math.Round),
+	"truncate":              roundFunction(math.Trunc),
+	"round":                 roundFunction(math.Round),
+	"floor":                 roundFunction(math.Floor),
+	"ceiling":               roundFunction(math.Ceil),
+}
+
+var binaryFunctions = map[Atom]binaryFunction{
+	"+":   {add, bigAdd, floatFunction2(func(x, y float64) float64 { return x + y })},
+	"-":   {sub, bigSub, floatFunction2(func(x, y float64) float64 { return x - y })},
+	"*":   {mul, bigMul, floatFunction2(func(x, y float64) float64 { return x * y })},
+	"/":   {divide, bigDivide, floatDivide},
+	"//":  {small: intDiv, big: bigIntDiv},
+	"mod": {small: mod, big: bigMod},
+	"rem": {small: rem, big: bigRem},
+	"div": {small: floorDiv, big: bigFloorDiv},
+	"min": {
+		func(x, y Int, ctx Indicator) (Term, error) { return min(x, y), nil },
+		func(x, y *big.Int, ctx Indicator) (Term, error) {
+			if x.Cmp(y) <= 0 {
+				return NewInt(x), nil
+			}
+			return NewInt(y), nil
+		},
+		floatFunction2(math.Min),
+	},
+	"max": {
+		func(x, y Int, ctx Indicator) (Term, error) { return max(x, y), nil },
+		func(x, y *big.Int, ctx Indicator) (Term, error) {
+			if x.Cmp(y) >= 0 {
+				return NewInt(x), nil
+			}
+			return NewInt(y), nil
+		},
+		floatFunction2(math.Max),
+	},
+	"gcd": {small: gcd, big: bigGcd},
+	">>":  {small: shiftRight, big: bigShiftRight},
+	"<<":  {small: shiftLeft, big: bigShiftLeft},
+	"/\\": {
+		small: func(x, y Int, ctx Indicator) (Term, error) { return x & y, nil },
+		big:   func(x, y *big.Int, ctx Indicator) (Term, error) { return NewInt(x.And(x, y)), nil },
+	},
+	"\\/": {
+		small: func(x, y Int, ctx Indicator) (Term, error) { return x | y, nil },
+		big:   func(x, y *big.Int, ctx Indicator) (Term, error) { return NewInt(x.Or(x, y)), nil },
+	},
+	"xor": {
+		small: func(x, y Int, ctx Indicator) (Term, error) { return x ^ y, nil },
+		big:   func(x, y *big.Int, ctx Indicator) (Term, error) { return NewInt(x.Xor(x, y)), nil },
+	},
+	"**":    {pow, bigPow, floatPow},
+	"^":     {intPow, bigIntPow, floatPow},
+	"atan":  {float: floatFunction2(math.Atan2)},
+	"atan2": {float: floatFunction2(math.Atan2)},
+	"log":   {float: logBase},
+}
+
+// floatFunction2 wraps a binary function from math that returns a float.
+func floatFunction2(f func(x, y float64) float64) func(x, y float64, ctx Indicator) (Term, error) {
+	return func(x, y float64, ctx Indicator) (Term, error) {
+		return newFloat(f(x, y), ctx)
+	}
+}
+
+func floatSign(x float64, ctx Indicator) (Term, error) {
+	switch {
+	case x > 0:
+		return Float(1), nil
+	case x < 0:
+		return Float(-1), nil
+	default:
+		return Float(0), nil
+	}
+}
+
+func sqrt(x float64, ctx Indicator) (Term, error) {
+	if x < 0 {
+		return nil, evaluationError("undefined", ctx)
+	}
+	return newFloat(math.Sqrt(x), ctx)
+}
+
+func logarithm(x float64, ctx Indicator) (Term, error) {
+	if x <= 0 {
+		return nil, evaluationError("undefined", ctx)
+	}
+	return newFloat(math.Log(x), ctx)
+}
+
+// logBase returns the logarithm of y in base x.
+func logBase(x, y float64, ctx Indicator) (Term, error) {
+	if x <= 0 || y <= 0 || x == 1 {
+		return nil, evaluationError("undefined", ctx)
+	}
+	return newFloat(math.Log(y)/math.Log(x), ctx)
+}
+
+func neg(x Int, ctx Indicator) (Term, error) {
+	if x == math.MinInt {
+		return nil, errIntOverflow
+	}
+	return -x, nil
+}
+
+func bigNeg(x *big.Int, ctx Indicator) (Term, error) {
+	return NewInt(x.Neg(x)), nil
+}
+
+func abs(x Int, ctx Indicator) (Term, error) {
+	if x < 0 {
+		return neg(x, ctx)
+	}
+	return x, nil
+}
+
+func bigAbs(x *big.Int, ctx Indicator) (Term, error) {
+	return NewInt(x.Abs(x)), nil
+}
+
+func sign(x Int, ctx Indicator) (Term, error) {
+	switch {
+	case x > 0:
+		return Int(1), nil
+	case x < 0:
+		return Int(-1), nil
+	default:
+		return Int(0), nil
+	}
+}
+
+func bigSign(x *big.Int, ctx Indicator) (Term, error) {
+	return Int(x.Sign()), nil
+}
+
+// msb returns the position of the most significant bit of a positive integer.
+func msb(x Int, ctx Indicator) (Term, error) {
+	if x <= 0 {
+		return nil, domainError("positive_integer", x, ctx)
+	}
+	return Int(bits.Len(uint(x)) - 1), nil
+}
+
+func bigMsb(x *big.Int, ctx Indicator) (Term, error) {
+	if x.Sign() <= 0 {
+		return nil, domainError("positive_integer", NewInt(x), ctx)
+	}
+	return Int(x.BitLen() - 1), nil
+}
+
+func add(x, y Int, ctx Indicator) (Term, error) {
+	z := x + y
+	if (x > 0 && y > 0 && z < 0) || (x < 0 && y < 0 && z >= 0) {
+		return nil, errIntOverflow
+	}
+	return z, nil
+}
+
+func bigAdd(x, y *big.Int, ctx Indicator) (Term, error) {
+	return NewInt(x.Add(x, y)), nil
+}
+
+func sub(x, y Int, ctx Indicator) (Term, error) {
+	z := x - y
+	if (x >= 0 && y < 0 && z < 0) || (x < 0 && y > 0 && z >= 0) {
+		return nil, errIntOverflow
+	}
+	return z, nil
+}
+
+func bigSub(x, y *big.Int, ctx Indicator) (Term, error) {
+	return NewInt(x.Sub(x, y)), nil
+}
+
+func mul(x, y Int, ctx Indicator) (Term, error) {
+	if x == 0 || y == 0 {
+		return Int(0), nil
+	}
+	z := x * y
+	if z/y != x || (x == -1 && y == math.MinInt) || (y == -1 && x == math.MinInt) {
+		return nil, errIntOverflow
+	}
+	return z, nil
+}
+
+func bigMul(x, y *big.Int, ctx Indicator) (Term, error) {
+	return NewInt(x.Mul(x, y)), nil
+}
+
+// divide returns an integer if the division is exact, or a float otherwise.
+func divide(x, y Int, ctx Indicator) (Term, error) {
+	if y == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	if x == math.MinInt && y == -1 {
+		return nil, errIntOverflow
+	}
+	if x%y == 0 {
+		return x / y, nil
+	}
+	return floatDivide(float64(x), float64(y), ctx)
+}
+
+func bigDivide(x, y *big.Int, ctx Indicator) (Term, error) {
+	if y.Sign() == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() == 0 {
+		return NewInt(q), nil
+	}
+	z, _ := new(big.Rat).SetFrac(x, y).Float64()
+	return newFloat(z, ctx)
+}
+
+func floatDivide(x, y float64, ctx Indicator) (Term, error) {
+	if y == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	return newFloat(x/y, ctx)
+}
+
+// intDiv divides integers, truncating towards zero.
+func intDiv(x, y Int, ctx Indicator) (Term, error) {
+	if y == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	if x == math.MinInt && y == -1 {
+		return nil, errIntOverflow
+	}
+	return x / y, nil
+}
+
+func bigIntDiv(x, y *big.Int, ctx Indicator) (Term, error) {
+	if y.Sign() == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	return NewInt(x.Quo(x, y)), nil
+}
+
+// floorDiv divides integers, rounding towards negative infinity.
+func floorDiv(x, y Int, ctx Indicator) (Term, error) {
+	q, err := intDiv(x, y, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if (x%y != 0) && ((x < 0) != (y < 0)) {
+		return q.(Int) - 1, nil
+	}
+	return q, nil
+}
+
+func bigFloorDiv(x, y *big.Int, ctx Indicator) (Term, error) {
+	if y.Sign() == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() != 0 && r.Sign() != y.Sign() {
+		q.Sub(q, big.NewInt(1))
+	}
+	return NewInt(q), nil
+}
+
+// mod returns the remainder of floored division, which has the same sign as the divisor.
+func mod(x, y Int, ctx Indicator) (Term, error) {
+	if y == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	if y == -1 {
+		return Int(0), nil
+	}
+	z := x % y
+	if z != 0 && (z < 0) != (y < 0) {
+		z += y
+	}
+	return z, nil
+}
+
+func bigMod(x, y *big.Int, ctx Indicator) (Term, error) {
+	if y.Sign() == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	z := new(big.Int).Rem(x, y)
+	if z.Sign() != 0 && z.Sign() != y.Sign() {
+		z.Add(z, y)
+	}
+	return NewInt(z), nil
+}
+
+// rem returns the remainder of truncated division, which has the same sign as the dividend.
+func rem(x, y Int, ctx Indicator) (Term, error) {
+	if y == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	if y == -1 {
+		return Int(0), nil
+	}
+	return x % y, nil
+}
+
+func bigRem(x, y *big.Int, ctx Indicator) (Term, error) {
+	if y.Sign() == 0 {
+		return nil, evaluationError("zero_divisor", ctx)
+	}
+	return NewInt(x.Rem(x, y)), nil
+}
+
+func gcd(x, y Int, ctx Indicator) (Term, error) {
+	a, b := uint(x), uint(y)
+	if x < 0 {
+		a = -a
+	}
+	if y < 0 {
+		b = -b
+	}
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if a > math.MaxInt {
+		return nil, errIntOverflow
+	}
+	return Int(a), nil
+}
+
+func bigGcd(x, y *big.Int, ctx Indicator) (Term, error) {
+	return NewInt(new(big.Int).GCD(nil, nil, x.Abs(x), y.Abs(y))), nil
+}
+
+func shiftRight(x, y Int, ctx Indicator) (Term, error) {
+	if y < 0 {
+		if y == math.MinInt {
+			return nil, errIntOverflow
+		}
+		return shiftLeft(x, -y, ctx)
+	}
+	return x >> uint(y), nil
+}
+
+func bigShiftRight(x, y *big.Int, ctx Indicator) (Term, error) {
+	return bigShiftLeft(x, new(big.Int).Neg(y), ctx)
+}
+
+func shiftLeft(x, y Int, ctx Indicator) (Term, error) {
+	if y < 0 {
+		if y == math.MinInt {
+			return Int(0), nil
+		}
+		return shiftRight(x, -y, ctx)
+	}
+	if x == 0 {
+		return Int(0), nil
+	}
+	z := x << uint(y)
+	if y >= bits.UintSize || z>>uint(y) != x {
+		return nil, errIntOverflow
+	}
+	return z, nil
+}
+
+func bigShiftLeft(x, y *big.Int, ctx Indicator) (Term, error) {
+	if !y.IsInt64() || y.Int64() > math.MaxInt32 || y.Int64() < math.MinInt32 {
+		if x.Sign() == 0 || y.Sign() > 0 {
+			return nil, resourceError("memory", ctx)
+		}
+		// Shifting right by a huge amount.
+		if x.Sign() < 0 {
+			return Int(-1), nil
+		}
+		return Int(0), nil
+	}
+	if n := y.Int64(); n < 0 {
+		return NewInt(x.Rsh(x, uint(-n))), nil
+	}
+	return NewInt(x.Lsh(x, uint(y.Int64()))), nil
+}
+
+// intPow raises an integer to an integer power.
+//
+// Negative exponents are only allowed for bases 1 and -1, as other results wouldn't be
+// integers.
+func intPow(x, y Int, ctx Indicator) (Term, error) {
+	if y < 0 {
+		switch x {
+		case 1:
+			return Int(1), nil
+		case -1:
+			if y%2 == 0 {
+				return Int(1), nil
+			}
+			return Int(-1), nil
+		case 0:
+			return nil, evaluationError("zero_divisor", ctx)
+		default:
+			return nil, typeError("float", x, ctx)
+		}
+	}
+	var z Term = Int(1)
+	base := x
+	for {
+		if y&1 == 1 {
+			var err error
+			if z, err = mul(z.(Int), base, ctx); err != nil {
+				return nil, err
+			}
+		}
+		y >>= 1
+		if y == 0 {
+			return z, nil
+		}
+		b, err := mul(base, base, ctx)
+		if err != nil {
+			return nil, err
+		}
+		base = b.(Int)
+	}
+}
+
+func bigIntPow(x, y *big.Int, ctx Indicator) (Term, error) {
+	if x.IsInt64() && x.Int64() >= -1 && x.Int64() <= 1 {
+		// Only the exponent's sign and parity matter for bases -1, 0 and 1.
+		exp := Int(y.Sign() * (2 - int(y.Bit(0))))
+		return intPow(Int(x.Int64()), exp, ctx)
+	}
+	if y.Sign() < 0 {
+		return nil, typeError("float", NewInt(x), ctx)
+	}
+	if !y.IsInt64() || y.Int64() > math.MaxInt32 {
+		return nil, resourceError("memory", ctx)
+	}
+	return NewInt(x.Exp(x, y, nil)), nil
+}
+
+// pow raises a number to a power, resulting in an integer if both are integers and the
+// exponent is not negative.
+func pow(x, y Int, ctx Indicator) (Term, error) {
+	if y < 0 && x != 1 && x != -1 {
+		return floatPow(float64(x), float64(y), ctx)
+	}
+	return intPow(x, y, ctx)
+}
+
+func bigPow(x, y *big.Int, ctx Indicator) (Term, error) {
+	if y.Sign() < 0 && x.CmpAbs(big.NewInt(1)) != 0 {
+		x1, _ := new(big.Float).SetInt(x).Float64()
+		y1, _ := new(big.Float).SetInt(y).Float64()
+		return floatPow(x1, y1, ctx)
+	}
+	return bigIntPow(x, y, ctx)
+}
+
+func floatPow(x, y float64, ctx Indicator) (Term, error) {
+	if x == 0 && y < 0 {
+		return nil, evaluationError("zero_divisor", ctx)
 	}
+	return newFloat(math.Pow(x, y), ctx)
 }
@@ -1,8 +1,11 @@
 package prol_test
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
 	"github.com/brunokim/prol-go/prol"
 )
 
@@ -17,6 +20,55 @@ func TestEval(t *testing.T) {
 		{"Sum", s("+", int_(10), int_(2)), int_(12)},
 		{"Neg", s("-", int_(10)), int_(-10)},
 		{"Pos", s("+", int_(10)), int_(+10)},
+		{"Mul", s("*", int_(6), int_(-7)), int_(-42)},
+		{"IntDiv", s("//", int_(-7), int_(2)), int_(-3)},
+		{"Div", s("div", int_(-7), int_(2)), int_(-4)},
+		{"Mod", s("mod", int_(-7), int_(2)), int_(1)},
+		{"Mod negative divisor", s("mod", int_(7), int_(-2)), int_(-1)},
+		{"Rem", s("rem", int_(-7), int_(2)), int_(-1)},
+		{"Abs", s("abs", int_(-3)), int_(3)},
+		{"Sign", s("sign", int_(-3)), int_(-1)},
+		{"Min", s("min", int_(2), int_(3)), int_(2)},
+		{"Max", s("max", int_(2), int_(3)), int_(3)},
+		{"Gcd", s("gcd", int_(12), int_(-18)), int_(6)},
+		{"Shift right", s(">>", int_(-16), int_(2)), int_(-4)},
+		{"Shift left", s("<<", int_(3), int_(4)), int_(48)},
+		{"And", s("/\\", int_(12), int_(10)), int_(8)},
+		{"Or", s("\\/", int_(12), int_(10)), int_(14)},
+		{"Xor", s("xor", int_(12), int_(10)), int_(6)},
+		{"Not", s("\\", int_(0)), int_(-1)},
+		{"Msb", s("msb", int_(1000)), int_(9)},
+		{"Pow", s("**", int_(3), int_(4)), int_(81)},
+		{"Caret", s("^", int_(-2), int_(3)), int_(-8)},
+		{"Caret negative exponent", s("^", int_(-1), int_(-3)), int_(-1)},
+		{"Promote sum", s("+", a("max_integer"), int_(1)), prol.BigInt("9223372036854775808")},
+		{"Promote neg", s("-", a("min_integer")), prol.BigInt("9223372036854775808")},
+		{"Promote mul", s("*", a("max_integer"), int_(2)), prol.BigInt("18446744073709551614")},
+		{"Promote shift", s("<<", int_(1), int_(64)), prol.BigInt("18446744073709551616")},
+		{"Promote pow", s("**", int_(2), int_(100)), prol.BigInt("1267650600228229401496703205376")},
+		{"Demote", s("-", s("+", a("max_integer"), int_(1)), int_(1)), int_(9223372036854775807)},
+		{"Big div", s("div", s("-", s("^", int_(10), int_(20))), int_(7)), prol.BigInt("-14285714285714285715")},
+		{"Big mod", s("mod", s("-", s("^", int_(10), int_(20))), int_(7)), int_(5)},
+		{"Big compare", s("max", s("^", int_(10), int_(20)), s("^", int_(2), int_(70))), prol.BigInt("1180591620717411303424")},
+		{"Big msb", s("msb", s("^", int_(2), int_(70))), int_(70)},
+		{"Float", float_(1.5), float_(1.5)},
+		{"Mixed sum", s("+", int_(1), float_(2.5)), float_(3.5)},
+		{"Exact division", s("/", int_(6), int_(3)), int_(2)},
+		{"Inexact division", s("/", int_(7), int_(2)), float_(3.5)},
+		{"Float pow negative exponent", s("**", int_(2), int_(-1)), float_(0.5)},
+		{"Float caret", s("^", float_(2), int_(3)), float_(8)},
+		{"Sqrt", s("sqrt", int_(16)), float_(4)},
+		{"Sin", s("sin", int_(0)), float_(0)},
+		{"Exp", s("exp", int_(0)), float_(1)},
+		{"Log", s("log", a("e")), float_(1)},
+		{"Float conversion", s("float", int_(3)), float_(3)},
+		{"Float sign", s("sign", float_(-2.5)), float_(-1)},
+		{"Truncate", s("truncate", float_(-2.5)), int_(-2)},
+		{"Round", s("round", float_(2.5)), int_(3)},
+		{"Floor", s("floor", float_(-0.5)), int_(-1)},
+		{"Ceiling", s("ceiling", float_(0.5)), int_(1)},
+		{"Floor big", s("floor", float_(1e20)), prol.BigInt("100000000000000000000")},
+		{"Nested", s("+", s("*", int_(2), int_(3)), s("mod", int_(10), int_(4))), int_(8)},
 	}
 
 	for _, test := range tests {
@@ -32,3 +84,56 @@ func TestEval(t *testing.T) {
 		})
 	}
 }
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr prol.Term
+		want prol.Term
+	}{
+		{"Unbound", s("+", ref("X"), int_(1)), a("instantiation_error")},
+		{"Not evaluable", s("foo", int_(1)), s("type_error", a("evaluable"), s("/", a("foo"), int_(1)))},
+		{"Atom", a("foo"), s("type_error", a("evaluable"), s("/", a("foo"), int_(0)))},
+		{"Zero divisor", s("//", int_(1), int_(0)), s("evaluation_error", a("zero_divisor"))},
+		{"Mod zero", s("mod", int_(1), int_(0)), s("evaluation_error", a("zero_divisor"))},
+		{"Negative exponent", s("^", int_(2), int_(-1)), s("type_error", a("float"), int_(2))},
+		{"Float zero divisor", s("/", int_(1), float_(0)), s("evaluation_error", a("zero_divisor"))},
+		{"Float in integer function", s("mod", float_(1.5), int_(2)), s("type_error", a("integer"), float_(1.5))},
+		{"Sqrt of negative", s("sqrt", int_(-1)), s("evaluation_error", a("undefined"))},
+		{"Log of zero", s("log", int_(0)), s("evaluation_error", a("undefined"))},
+		{"Float overflow", s("exp", int_(1000)), s("evaluation_error", a("float_overflow"))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := prol.Eval(test.expr)
+			var perr *prol.PrologError
+			if !errors.As(err, &perr) {
+				t.Fatalf("want PrologError, got %v", err)
+			}
+			got := perr.Term.(prol.Struct).Args[0]
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("(-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestFloatString(t *testing.T) {
+	tests := []struct {
+		f    prol.Float
+		want string
+	}{
+		{1, "1.0"},
+		{-2.5, "-2.5"},
+		{0.1, "0.1"},
+		{1e21, "1.0e21"},
+		{1.5e-10, "1.5e-10"},
+		{123456789012, "1.23456789012e11"},
+		{100000, "100000.0"},
+	}
+	for _, test := range tests {
+		if got := test.f.String(); got != test.want {
+			t.Errorf("%v: want %q, got %q", float64(test.f), test.want, got)
+		}
+	}
+}
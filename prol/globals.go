@@ -0,0 +1,172 @@
+package prol
+
+// --- Global variables ---
+//
+// Global variables associate an atom to a term, within a query. Values set with b_setval/2
+// are restored on backtracking, like bindings, while values set with nb_setval/2 are
+// copied and survive backtracking.
+//
+// Counters set with flag/3 are stored in the database, so they persist across queries.
+
+// Global returns the value of a global variable.
+func (s *solver) Global(name Atom) (Term, bool) {
+	value, ok := s.globals[name]
+	return value, ok
+}
+
+// SetGlobal sets the value of a global variable. If backtrackable, the previous value is
+// restored on backtracking; otherwise, the value is copied so that it survives
+// backtracking over its bindings.
+func (s *solver) SetGlobal(name Atom, value Term, backtrackable bool) {
+	if !backtrackable {
+		s.globals[name] = copyTerm(value, make(map[*Ref]*Ref), s.NewRef)
+		return
+	}
+	s.trail = append(s.trail, trailEntry{kind: trailGlobal, name: name, old: s.globals[name]})
+	s.globals[name] = value
+}
+
+// Counter returns the value of a counter, or 0 if it was never set.
+func (db *Database) Counter(key Atom) Term {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.counter(key)
+}
+
+func (db *Database) counter(key Atom) Term {
+	value, ok := db.counters[key]
+	if !ok {
+		return Int(0)
+	}
+	return value
+}
+
+// SetCounter sets the value of a counter.
+func (db *Database) SetCounter(key Atom, value Term) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.own()
+	db.counters[key] = value
+}
+
+// UpdateCounter atomically replaces the value of a counter with the result of update. The
+// counter is unchanged if update returns nil or an error.
+func (db *Database) UpdateCounter(key Atom, update func(old Term) (Term, error)) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	value, err := update(db.counter(key))
+	if err != nil || value == nil {
+		return err
+	}
+	db.own()
+	db.counters[key] = value
+	return nil
+}
+
+func (s *solver) Counter(key Atom) Term {
+	return s.db.Counter(key)
+}
+
+func (s *solver) SetCounter(key Atom, value Term) {
+	s.db.SetCounter(key, value)
+}
+
+func (s *solver) UpdateCounter(key Atom, update func(old Term) (Term, error)) error {
+	return s.db.UpdateCounter(key, update)
+}
+
+// toGlobalName validates the name argument of the global variable builtins.
+func toGlobalName(goal Goal) (Atom, error) {
+	arg1 := Deref(goal.Term.Args[0])
+	name, ok := arg1.(Atom)
+	if !ok {
+		return "", typeOrInstantiationError("atom", arg1, goal.Term.Indicator())
+	}
+	return name, nil
+}
+
+func bSetvalBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	name, err := toGlobalName(goal)
+	if err != nil {
+		return isError(err)
+	}
+	s.SetGlobal(name, goal.Term.Args[1], true)
+	return isSuccess(true)
+}
+
+func nbSetvalBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	name, err := toGlobalName(goal)
+	if err != nil {
+		return isError(err)
+	}
+	s.SetGlobal(name, goal.Term.Args[1], false)
+	return isSuccess(true)
+}
+
+// getvalBuiltin implements both b_getval/2 and nb_getval/2, that access the same variables.
+func getvalBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	name, err := toGlobalName(goal)
+	if err != nil {
+		return isError(err)
+	}
+	value, ok := s.Global(name)
+	if !ok {
+		return isError(existenceError("variable", name, goal.Term.Indicator()))
+	}
+	return isSuccess(s.Unify(goal.Term.Args[1], value))
+}
+
+// flag(Key, Old, New) unifies Old with the counter's value, and sets it to the evaluation of New.
+func flagBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	key, err := toGlobalName(goal)
+	if err != nil {
+		return isError(err)
+	}
+	// The counter is updated atomically, since other queries may be running concurrently.
+	var ok bool
+	err = s.UpdateCounter(key, func(old Term) (Term, error) {
+		if ok = s.Unify(goal.Term.Args[1], old); !ok {
+			return nil, nil
+		}
+		return eval(goal.Term.Args[2], goal.Term.Indicator())
+	})
+	if err != nil {
+		return isError(err)
+	}
+	return isSuccess(ok)
+}
+
+// succ(X, Y) holds if Y = X+1 and X >= 0.
+func succBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	x, y := Deref(goal.Term.Args[0]), Deref(goal.Term.Args[1])
+	for _, arg := range []Term{x, y} {
+		if _, ok := arg.(*Ref); ok {
+			continue
+		}
+		if !isInteger(arg) {
+			return isError(typeError("integer", arg, ctx))
+		}
+		if compareNumbers(arg, Int(0)) < 0 {
+			return isError(typeError("not_less_than_zero", arg, ctx))
+		}
+	}
+	if _, ok := x.(*Ref); !ok {
+		next, err := eval(Struct{"+", []Term{x, Int(1)}}, ctx)
+		if err != nil {
+			return isError(err)
+		}
+		return isSuccess(s.Unify(y, next))
+	}
+	if _, ok := y.(*Ref); ok {
+		return isError(instantiationError(ctx))
+	}
+	if y == Int(0) {
+		return isSuccess(false)
+	}
+	prev, err := eval(Struct{"-", []Term{y, Int(1)}}, ctx)
+	if err != nil {
+		return isError(err)
+	}
+	return isSuccess(s.Unify(x, prev))
+}
@@ -30,6 +30,17 @@ int_chars(Int, Chars) :-
   int_to_chars(Int, Chars).
 
 
+doc(float_chars, converts_between_a_float_and_a_list_of_chars).
+
+float_chars(Float, Chars) :-
+  var(Float),
+  is_char_list(Chars),
+  chars_to_float(Chars, Float).
+float_chars(Float, Chars) :-
+  float(Float),
+  float_to_chars(Float, Chars).
+
+
 doc(is_char_list, tests_whether_list_is_composed_only_of_one_char_atoms).
 
 is_char_list(\.(Char, Chars)) :-
@@ -114,6 +125,8 @@ parse_term(Term, L0, L) :-
   parse_atom(Term, L0, L).
 parse_term(Term, L0, L) :-
   parse_var(Term, L0, L).
+parse_term(Term, L0, L) :-
+  parse_float(Term, L0, L).
 parse_term(Term, L0, L) :-
   parse_int(Term, L0, L).
 
@@ -168,6 +181,45 @@ parse_int(int(Int), L0, L) :-
   int_chars(Int, \.(Char, Chars)).
 
 
+doc(parse_float, parses_a_floating_point_number).
+doc(a_float_has_digits, a_fraction_with_at_least_one_digit, and_an_optional_exponent).
+
+parse_float(float(Float), L0, L) :-
+  \=(L0, \.(Char, L1)),
+  ascii_digit(Char),
+  float_text(Chars, L1, L),
+  float_chars(Float, \.(Char, Chars)).
+
+float_text(\.(Char, Chars), L0, L) :-
+  \=(L0, \.(Char, L1)),
+  ascii_digit(Char),
+  float_text(Chars, L1, L).
+float_text(\.(\., \.(Char, Chars)), L0, L) :-
+  \=(L0, \.(\., \.(Char, L1))),
+  ascii_digit(Char),
+  fraction_text(Chars, L1, L).
+
+fraction_text(\.(Char, Chars), L0, L) :-
+  \=(L0, \.(Char, L1)),
+  ascii_digit(Char),
+  fraction_text(Chars, L1, L).
+fraction_text(\.(Char, Chars), L0, L) :-
+  \=(L0, \.(Char, L1)),
+  exponent_char(Char),
+  exponent_text(Chars, L1, L).
+fraction_text([], L, L).
+
+exponent_text(\.(Sign, \.(Char, Chars)), L0, L) :-
+  \=(L0, \.(Sign, \.(Char, L1))),
+  sign_char(Sign),
+  ascii_digit(Char),
+  digits(Chars, L1, L).
+exponent_text(\.(Char, Chars), L0, L) :-
+  \=(L0, \.(Char, L1)),
+  ascii_digit(Char),
+  digits(Chars, L1, L).
+
+
 doc(ident_chars, parses_a_sequence_of_identifier_chars).
 
 ident_chars(\.(Char, Chars), L0, L) :-
@@ -212,6 +264,12 @@ ident(Char) :-
 ident(Char) :-
   ascii_digit(Char).
 
+exponent_char(\e).
+exponent_char(\E).
+
+sign_char(\+).
+sign_char(\-).
+
 ascii_digit(\0).
 ascii_digit(\1).
 ascii_digit(\2).
@@ -33,6 +33,8 @@ lex_token(Token, S0, S, L0, L) :-
   lex_atom(Token, S0, S, L0, L).
 lex_token(Token, S0, S, L0, L) :-
   lex_var(Token, S0, S, L0, L).
+lex_token(Token, S0, S, L0, L) :-
+  lex_float(Token, S0, S, L0, L).
 lex_token(Token, S0, S, L0, L) :-
   lex_int(Token, S0, S, L0, L).
 lex_token(Token, S0, S, L0, L) :-
@@ -76,6 +78,46 @@ lex_int(token(int, \.(Char, Chars), S0), S0, S, L0, L) :-
   lex_digits(Chars, S1, S, L1, L).
 
 
+% lex_float//3 extracts a floating-point number from the character list. A float has an integer
+% part, a fraction with at least one digit, and an optional exponent, like 1.5 or 1.0e-10.
+
+lex_float(token(float, \.(Char, Chars), S0), S0, S, L0, L) :-
+  read_char(Char, S0, S1, L0, L1),
+  ascii_digit(Char),
+  lex_float_chars(Chars, S1, S, L1, L).
+
+lex_float_chars(\.(Char, Chars), S0, S, L0, L) :-
+  read_char(Char, S0, S1, L0, L1),
+  ascii_digit(Char),
+  lex_float_chars(Chars, S1, S, L1, L).
+lex_float_chars(\.(\., \.(Char, Chars)), S0, S, L0, L) :-
+  read_char(\., S0, S1, L0, L1),
+  read_char(Char, S1, S2, L1, L2),
+  ascii_digit(Char),
+  lex_fraction(Chars, S2, S, L2, L).
+
+lex_fraction(\.(Char, Chars), S0, S, L0, L) :-
+  read_char(Char, S0, S1, L0, L1),
+  ascii_digit(Char),
+  lex_fraction(Chars, S1, S, L1, L).
+lex_fraction(\.(Char, Chars), S0, S, L0, L) :-
+  read_char(Char, S0, S1, L0, L1),
+  exponent_char(Char),
+  lex_exponent(Chars, S1, S, L1, L).
+lex_fraction([], S, S, L, L).
+
+lex_exponent(\.(Sign, \.(Char, Chars)), S0, S, L0, L) :-
+  read_char(Sign, S0, S1, L0, L1),
+  sign_char(Sign),
+  read_char(Char, S1, S2, L1, L2),
+  ascii_digit(Char),
+  lex_digits(Chars, S2, S, L2, L).
+lex_exponent(\.(Char, Chars), S0, S, L0, L) :-
+  read_char(Char, S0, S1, L0, L1),
+  ascii_digit(Char),
+  lex_digits(Chars, S1, S, L1, L).
+
+
 % lex_whitespace//3 extracts whitespace from the character list. Whitespace may be an arbitrary number of
 % spaces or newlines; or a line comment starting with '%' and ending with a newline.
 %
@@ -155,3 +197,9 @@ identifier_char(Char) :-
   ascii_digit(Char).
 
 line_comment_start(\%).
+
+exponent_char(\e).
+exponent_char(\E).
+
+sign_char(\+).
+sign_char(\-).
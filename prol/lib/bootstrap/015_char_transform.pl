@@ -20,6 +20,17 @@ int_chars(Int, Chars) :-
   int_to_chars(Int, Chars).
 
 
+% float_chars/2 converts between a float and its list of characters representation.
+
+float_chars(Float, Chars) :-
+  var(Float),
+  is_char_list(Chars),
+  chars_to_float(Chars, Float).
+float_chars(Float, Chars) :-
+  float(Float),
+  float_to_chars(Float, Chars).
+
+
 % is_char_list/2 checks whether the list is composed only of one-char atoms.
 
 is_char_list(\.(Char, Chars)) :-
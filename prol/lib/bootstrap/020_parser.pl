@@ -78,6 +78,8 @@ parse_term(Term, T0, T) :-
   parse_atom(Term, T0, T).
 parse_term(Term, T0, T) :-
   parse_var(Term, T0, T).
+parse_term(Term, T0, T) :-
+  parse_float(Term, T0, T).
 parse_term(Term, T0, T) :-
   parse_int(Term, T0, T).
 
@@ -122,6 +124,13 @@ parse_int(int(Int), T0, T) :-
   int_chars(Int, Text).
 
 
+% parse_float//1 parses a floating-point number from the token stream.
+
+parse_float(float(Float), T0, T) :-
+  \=(T0, \.(token(float, Text, _), T)),
+  float_chars(Float, Text).
+
+
 % ws//0 consumes zero or more whitespace tokens.
 
 ws(T0, T) :-
@@ -42,6 +42,9 @@ ascii_symbol('*').
 ascii_symbol('/').
 ascii_symbol('^').
 ascii_symbol('\').
+ascii_symbol(':').
+ascii_symbol('@').
+ascii_symbol('#').
 
 parse_symbol(atom(Name)) -->
   symbol_chars(Chars),
@@ -61,6 +64,26 @@ parse_atom(Atom) -->
 
 test_parse_symbol(=, ==, =<, >=, ++, **, -*/*-).
 
+% Atoms must be read whole, otherwise when backtracking ":-" could be read as ":" followed
+% by "-", and a word like "module" as the operator "mod" followed by "ule". So we replace
+% the base cases of symbol_chars and ident_chars, that accept any prefix of an atom, with
+% ones that only end it before a char of another kind.
+
+symbol_chars([Char], [Char], []) :-
+  ascii_symbol(Char).
+symbol_chars([Char], [Char, Next|L], [Next|L]) :-
+  ascii_symbol(Char),
+  \+(ascii_symbol(Next)).
+
+ident_chars([], [], []).
+ident_chars([], [Char|L], [Char|L]) :-
+  \+(ident(Char)).
+
+:- get_predicate(indicator(symbol_chars, 3), [S1, S2, S3, S4]),
+   put_predicate(indicator(symbol_chars, 3), [S1, S3, S4]),
+   get_predicate(indicator(ident_chars, 3), [I1, I2, I3, I4]),
+   put_predicate(indicator(ident_chars, 3), [I1, I3, I4]).
+
 % Prolog allows for dynamic and user-defined operators.
 % They must be registered as a fact op/3 like op(600, xfy, +), where the args mean
 % - the operator precedence.
@@ -114,15 +137,39 @@ op(700, xfx, =).   % Unifies
 op(700, xfx, \=).  % Does not unify
 op(700, xfx, ==).  % Equivalent to
 op(700, xfx, \==). % Not equivalent to
+op(700, xfx, @<).  % Term less than
+op(700, xfx, @=<). % Term less or equal to
+op(700, xfx, @>).  % Term greater than
+op(700, xfx, @>=). % Term greater or equal to
 op(700, xfx, is).  % Arithmetic evaluation
+op(700, xfx, =:=). % Arithmetic equal to
+op(700, xfx, =\=). % Arithmetic not equal to
+op(700, xfx, #=).  % Constrained equal to
+op(700, xfx, #\=). % Constrained not equal to
+op(700, xfx, #<).  % Constrained less than
+op(700, xfx, #=<). % Constrained less or equal to
+op(700, xfx, #>).  % Constrained greater than
+op(700, xfx, #>=). % Constrained greater or equal to
+op(700, xfx, in).  % Constrained to domain
+op(700, xfx, ins). % All constrained to domain
 op(500, yfx, +).   % Addition
 op(500, yfx, -).   % Subtraction
+op(500, yfx, /\).  % Bitwise and
+op(500, yfx, \/).  % Bitwise or
+op(500, yfx, xor). % Bitwise exclusive or
 op(400, yfx, *).   % Multiplication
 op(400, yfx, /).   % Division (quotient)
+op(400, yfx, //).  % Integer division
 op(400, yfx, mod). % Remainder of division
+op(400, yfx, rem). % Remainder of truncated division
+op(400, yfx, div). % Floored integer division
+op(400, yfx, >>).  % Bit shift right
+op(400, yfx, <<).  % Bit shift left
+op(200, xfx, **).  % Power to
 op(200, xfy, ^).   % Power to
 op(200, fy, +).    % Positive (unary)
 op(200, fy, -).    % Negative (unary)
+op(200, xfy, :).   % Module qualification
 
 % op_type_position(Type, Position) relates an operator type with its position.
 op_type_position(fx, prefix).
@@ -168,6 +215,7 @@ right_precedence(Prec0, xfx, Prec) :-
 parse_atomic_term(Term) --> parse_struct(Term).
 parse_atomic_term(Term) --> parse_atom(Term).
 parse_atomic_term(Term) --> parse_var(Term).
+parse_atomic_term(Term) --> parse_float(Term).
 parse_atomic_term(Term) --> parse_int(Term).
 parse_atomic_term(Term) --> parse_list(Term).
 parse_atomic_term(Term) -->
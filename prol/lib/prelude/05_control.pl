@@ -0,0 +1,94 @@
+% Control constructs.
+%
+% The cut '!' is a goal that always succeeds, but commits the current predicate to the
+% clause where it appears: when backtracking into it, the remaining clauses are discarded,
+% as well as the alternatives for the goals before it in the clause body.
+%
+%     max(X, Y, X) :- X >= Y, !.
+%     max(_, Y, Y).
+%
+% It's a solo char, so it can't be combined with other symbols like an ordinary operator.
+
+parse_atom(atom('!')) --> "!".
+
+
+% Goals may also be written as expressions with operators, like "X = Y" or "X >= 2".
+
+parse_goal(Goal) -->
+  parse_expr(Goal),
+  { =(Goal, struct(_, _)) }.
+
+% Now a DCG rule head like "foo --> []" is also a valid expression "-(foo, >(-, []))", so
+% we need to parse DCGs before plain clauses.
+
+:- get_predicate(indicator(parse_rule, 3), [C1, C2, C3]),
+   put_predicate(indicator(parse_rule, 3), [C2, C1, C3]).
+
+
+% Goals may be combined with control constructs, that are written within parenthesis:
+%
+% - conjunction "(A, B)" executes A and then B;
+% - disjunction "(A ; B)" executes A, and B on backtracking;
+% - if-then-else "(Cond -> Then ; Else)" executes Then for the first solution of Cond,
+%   or Else if it has none;
+% - soft-cut "(Cond *-> Then ; Else)" executes Then for every solution of Cond, or Else
+%   if it has none.
+%
+% A conjunction binds tighter than if-then, which binds tighter than disjunction, so that
+% "(A, B -> C ; D, E)" is read as "((A, B) -> C) ; (D, E)".
+%
+% These are not registered as operators, since the expression parser doesn't limit the
+% precedence of arguments yet, and "A, B -> C" would be read as "A, (B -> C)".
+
+parse_goal(Goal) -->
+  "(",
+  ws,
+  parse_disjunction(Goal),
+  ws,
+  ")".
+
+% Whitespace is only consumed before an expected token, otherwise consecutive ws//0 calls
+% would backtrack over all ways to split the same spaces between them.
+
+parse_disjunction(Goal) -->
+  parse_if_then(Left),
+  parse_disjunction_rest(Left, Goal).
+
+parse_disjunction_rest(Left, struct(';', [Left, Right])) -->
+  ws,
+  ";",
+  ws,
+  parse_disjunction(Right).
+parse_disjunction_rest(Goal, Goal) --> [].
+
+parse_if_then(Goal) -->
+  parse_conjunction(Cond),
+  parse_if_then_rest(Cond, Goal).
+
+parse_if_then_rest(Cond, struct('->', [Cond, Then])) -->
+  ws,
+  "->",
+  ws,
+  parse_conjunction(Then).
+parse_if_then_rest(Cond, struct('*->', [Cond, Then])) -->
+  ws,
+  "*->",
+  ws,
+  parse_conjunction(Then).
+parse_if_then_rest(Goal, Goal) --> [].
+
+parse_conjunction(Goal) -->
+  parse_goal(First),
+  parse_conjunction_rest(First, Goal).
+
+parse_conjunction_rest(First, struct(',', [First, Rest])) -->
+  ws,
+  ",",
+  ws,
+  parse_conjunction(Rest).
+parse_conjunction_rest(Goal, Goal) --> [].
+
+
+% Negation "\+ Goal" succeeds only if Goal has no solutions.
+
+op(900, fy, \+).
@@ -13,12 +13,6 @@ append([H|L0], L1, [H|L2]) :-
 indicator(struct(Name, Args), indicator(Name, NumArgs)) :-
   length(Args, NumArgs).
 
-asserta(Clause) :-
-  =(Clause, clause(Head, _)),
-  indicator(Head, Ind),
-  get_predicate(Ind, Clauses0),
-  put_predicate(Ind, [Clause|Clauses0]).
-
 % assertz(Clause) :-
 %   =(Clause, clause(Head, _)),
 %   indicator(Head, Ind),
@@ -0,0 +1,325 @@
+package prol
+
+import (
+	"slices"
+
+	"github.com/brunokim/prol-go/kif"
+)
+
+// --- Modules ---
+//
+// Predicates belong to a module, identified by the Module field of their indicator. The
+// user module, with an empty name, contains all builtins and rules asserted outside of a
+// module.
+//
+// A source text starting with a ':- module(Name, Exports)' directive asserts its rules into
+// that module, until the end of the text. Goals in the body of these rules are qualified
+// with the module, like 'Name:Goal', so that they are looked up in it.
+//
+// An unqualified goal is looked up in its module, then in the predicates imported into it
+// with use_module/1,2, and finally in the user module.
+
+// module holds the interface of a module.
+type module struct {
+	exports []Indicator
+	// Imported predicates, without module, and the module where they are defined.
+	imports map[Indicator]Atom
+	// Value of the 'unknown' flag in the module, or nil to use the database default.
+	unknown *UnknownFlag
+}
+
+// metaArgs are the positions (0-based) of goal arguments of control constructs and
+// meta-predicates, that are executed in the context module of the caller.
+var metaArgs = map[Indicator][]int{
+	{Name: ",", Arity: 2}:                 {0, 1},
+	{Name: ";", Arity: 2}:                 {0, 1},
+	{Name: "->", Arity: 2}:                {0, 1},
+	{Name: "*->", Arity: 2}:               {0, 1},
+	{Name: "\\+", Arity: 1}:               {0},
+	{Name: "call", Arity: 1}:              {0},
+	{Name: "call", Arity: 2}:              {0},
+	{Name: "call", Arity: 3}:              {0},
+	{Name: "call", Arity: 4}:              {0},
+	{Name: "call", Arity: 5}:              {0},
+	{Name: "call", Arity: 6}:              {0},
+	{Name: "call", Arity: 7}:              {0},
+	{Name: "call", Arity: 8}:              {0},
+	{Name: "catch", Arity: 3}:             {0, 2},
+	{Name: "findall", Arity: 3}:           {1},
+	{Name: "bagof", Arity: 3}:             {1},
+	{Name: "setof", Arity: 3}:             {1},
+	{Name: "^", Arity: 2}:                 {1},
+	{Name: "forall", Arity: 2}:            {0, 1},
+	{Name: "freeze", Arity: 2}:            {1},
+	{Name: "when", Arity: 2}:              {1},
+	{Name: "predsort", Arity: 3}:          {0},
+	{Name: "assertz", Arity: 1}:           {0},
+	{Name: "asserta", Arity: 1}:           {0},
+	{Name: "retract", Arity: 1}:           {0},
+	{Name: "retractall", Arity: 1}:        {0},
+	{Name: "clause", Arity: 2}:            {0},
+	{Name: "current_predicate", Arity: 1}: {0},
+	{Name: "dynamic", Arity: 1}:           {0},
+	{Name: "abolish", Arity: 1}:           {0},
+	// Module-local flags are read and set in the context module.
+	{Name: "set_prolog_flag", Arity: 2}:     {0},
+	{Name: "current_prolog_flag", Arity: 2}: {0},
+}
+
+// qualify wraps the term as 'Module:Term', unless the module is the user module.
+func qualify(module Atom, t Term) Term {
+	if module == "" {
+		return t
+	}
+	return Struct{":", []Term{module, t}}
+}
+
+// unqualify strips module qualifications from a term like 'Module:Term', returning the
+// innermost module, or an empty module if it's not qualified.
+func unqualify(t Term, ctx Indicator) (Atom, Term, error) {
+	var module Atom
+	t = Deref(t)
+	for {
+		s, ok := t.(Struct)
+		if !ok || s.Indicator() != (Indicator{Name: ":", Arity: 2}) {
+			return module, t, nil
+		}
+		m := Deref(s.Args[0])
+		name, ok := m.(Atom)
+		if !ok {
+			return "", nil, typeOrInstantiationError("atom", m, ctx)
+		}
+		if name != "user" {
+			module = name
+		} else {
+			module = ""
+		}
+		t = Deref(s.Args[1])
+	}
+}
+
+// toQualifiedGoal converts a possibly qualified term into a goal, returning the indicator
+// of its predicate within the module.
+func toQualifiedGoal(t Term, ctx Indicator) (Goal, Indicator, error) {
+	module, t, err := unqualify(t, ctx)
+	if err != nil {
+		return Goal{}, Indicator{}, err
+	}
+	goal, err := toGoal(t, ctx)
+	if err != nil {
+		return Goal{}, Indicator{}, err
+	}
+	ind := goal.Term.Indicator()
+	ind.Module = module
+	return goal, ind, nil
+}
+
+// moduleRule returns the rule as it should be stored in the module, with its indicator.
+//
+// A rule with a qualified head like 'Module:Head' is stored in that module instead. Body
+// goals of rules outside of the user module are qualified with their module.
+func moduleRule(module Atom, rule Rule) (Rule, Indicator) {
+	f := rule.Indicator()
+	c, ok := rule.(Clause)
+	if !ok {
+		if dcg, ok := rule.(DCG); ok && module != "" {
+			f.Module = module
+			dcg.clause = qualifyBody(module, dcg.clause)
+			return dcg, f
+		}
+		return rule, f
+	}
+	if head := c[0].Term; f == (Indicator{Name: ":", Arity: 2}) {
+		if m, ok := Deref(head.Args[0]).(Atom); ok {
+			if g, err := toGoal(head.Args[1], f); err == nil {
+				module = m
+				c = slices.Concat(Clause{{Term: g.Term, LexerState: c[0].LexerState}}, c[1:])
+				f = g.Term.Indicator()
+			}
+		}
+	}
+	if module == "user" || module == "" {
+		return c, f
+	}
+	f.Module = module
+	return qualifyBody(module, c), f
+}
+
+// qualifyBody returns a copy of the clause with all body goals qualified with the module.
+func qualifyBody(module Atom, c Clause) Clause {
+	qualified := make(Clause, len(c))
+	qualified[0] = c[0]
+	for i, goal := range c[1:] {
+		qualified[i+1] = Goal{Term: Struct{":", []Term{module, goal.Term}}, LexerState: goal.LexerState}
+	}
+	return qualified
+}
+
+// resolve returns the indicator of the predicate called by a goal in the indicator's module.
+//
+// If the predicate is not found, returns the indicator itself, so that errors refer to it.
+func (db *Database) resolve(ind Indicator) Indicator {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if _, ok := db.index0[ind]; ok {
+		return ind
+	}
+	local := Indicator{Name: ind.Name, Arity: ind.Arity}
+	if m, ok := db.modules[ind.Module]; ok {
+		if from, ok := m.imports[local]; ok {
+			local.Module = from
+			return local
+		}
+	}
+	if _, ok := db.index0[local]; ok {
+		return local
+	}
+	return ind
+}
+
+// getModule returns the module with the given name, creating it if needed.
+func (db *Database) getModule(name Atom) *module {
+	m, ok := db.modules[name]
+	if !ok {
+		m = &module{imports: make(map[Indicator]Atom)}
+		db.modules[name] = m
+	}
+	return m
+}
+
+// loadContext is the state of a source text being interpreted, shared by the queries that
+// assert its rules, so that concurrent loads don't affect each other.
+type loadContext struct {
+	// Module of the rules being asserted, declared with module/2.
+	module Atom
+	// Whether the rules are being loaded from a text, so their predicates remain static.
+	loading bool
+}
+
+// withLoadContext executes the query as part of loading a source text.
+func withLoadContext(load *loadContext) SolveOption {
+	return solveOptionFunc(func(opts *SolveOptions) { opts.load = load })
+}
+
+// DeclareModule creates a module with its exported predicates.
+func (db *Database) DeclareModule(name Atom, exports []Indicator) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.own()
+	if name == "user" {
+		name = ""
+	}
+	m := db.getModule(name)
+	for _, ind := range exports {
+		ind.Module = name
+		m.exports = append(m.exports, ind)
+	}
+	db.Logger.Info(kif.KV{"msg", "module"}, kif.KV{"name", name}, kif.KV{"exports", exports})
+}
+
+// Import makes the predicates of a module callable without qualification from another
+// module. If inds is nil, all exported predicates are imported.
+//
+// Returns false if the module doesn't exist.
+func (db *Database) Import(into, from Atom, inds []Indicator) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if into == "user" {
+		into = ""
+	}
+	if from == "user" {
+		from = ""
+	}
+	m, ok := db.modules[from]
+	if !ok {
+		return false
+	}
+	if inds == nil {
+		inds = m.exports
+	}
+	db.own()
+	target := db.getModule(into)
+	for _, ind := range inds {
+		local := Indicator{Name: ind.Name, Arity: ind.Arity}
+		target.imports[local] = from
+	}
+	return true
+}
+
+// DeclareModule creates a module, and makes it the module of the rules asserted next, until
+// the end of the source text being loaded.
+func (s *solver) DeclareModule(name Atom, exports []Indicator) {
+	s.db.DeclareModule(name, exports)
+	if name == "user" {
+		name = ""
+	}
+	s.load.module = name
+}
+
+// Import makes the predicates of a module callable from the current module of the query.
+func (s *solver) Import(from Atom, inds []Indicator) bool {
+	return s.db.Import(s.load.module, from, inds)
+}
+
+// moduleControl executes the goal in the context of the module, so that it's looked up in
+// it. Goal arguments of control constructs and meta-predicates are qualified with the module,
+// and are transparent to cut.
+func moduleControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	g, ind, err := toQualifiedGoal(goal.Term, goal.Term.Indicator())
+	if err != nil {
+		return nil, false, err
+	}
+	local := g.Term.Indicator()
+	if positions, ok := metaArgs[local]; ok {
+		args := slices.Clone(g.Term.Args)
+		for _, i := range positions {
+			args[i] = qualify(ind.Module, args[i])
+		}
+		g = Goal{Term: Struct{g.Term.Name, args}, LexerState: g.LexerState}
+	}
+	if control, ok := controlConstructs[local]; ok {
+		return control(s, g, cutBarrier, env)
+	}
+	return s.call(g, s.db.resolve(ind), env)
+}
+
+func moduleBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	arg1 := Deref(goal.Term.Args[0])
+	name, ok := arg1.(Atom)
+	if !ok {
+		return isError(typeOrInstantiationError("atom", arg1, ctx))
+	}
+	exports, err := toIndicators(goal.Term.Args[1], ctx)
+	if err != nil {
+		return isError(err)
+	}
+	s.DeclareModule(name, exports)
+	return isSuccess(true)
+}
+
+// useModuleBuiltin implements use_module/1 and use_module/2, importing all or some predicates
+// of a module into the current module.
+func useModuleBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	ctx := goal.Term.Indicator()
+	arg1 := Deref(goal.Term.Args[0])
+	name, ok := arg1.(Atom)
+	if !ok {
+		return isError(typeOrInstantiationError("atom", arg1, ctx))
+	}
+	var inds []Indicator
+	if len(goal.Term.Args) > 1 {
+		var err error
+		inds, err = toIndicators(goal.Term.Args[1], ctx)
+		if err != nil {
+			return isError(err)
+		}
+		if inds == nil {
+			return isSuccess(true)
+		}
+	}
+	if !s.Import(name, inds) {
+		return isError(existenceError("module", name, ctx))
+	}
+	return isSuccess(true)
+}
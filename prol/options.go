@@ -0,0 +1,98 @@
+package prol
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// --- Solve options ---
+
+// SolveOptions configures the execution of a query. The zero value has no limits.
+//
+// It may be passed directly as a SolveOption, resetting all exported options set before it,
+// including those left with their zero value.
+type SolveOptions struct {
+	// Maximum depth of the search, or 0 for no limit.
+	MaxDepth int
+	// Maximum number of solutions, or 0 for no limit.
+	Limit int
+	// Maximum number of goals executed, or 0 for no limit.
+	MaxInferences int
+	// Whether unification performs the occurs check by default.
+	OccursCheck bool
+	// Output where each executed goal is printed, indented by its depth, or nil to disable.
+	// The depth is the nesting of calls: goals in the body of a rule are one level deeper
+	// than the goal that called it, and goals in the same body have the same depth.
+	Trace io.Writer
+	// Context that stops the search when done, or nil for context.Background().
+	Context context.Context
+	// Source text being loaded by the query, if any.
+	load *loadContext
+}
+
+// SolveOption modifies the options of a query.
+type SolveOption interface {
+	apply(opts *SolveOptions)
+}
+
+type solveOptionFunc func(opts *SolveOptions)
+
+func (f solveOptionFunc) apply(opts *SolveOptions) { f(opts) }
+
+func (o SolveOptions) apply(opts *SolveOptions) {
+	// Unexported state is only set within the package, and is kept.
+	o.load = opts.load
+	*opts = o
+}
+
+// WithMaxDepth limits the depth of the search, returning MaxDepthError when exceeded.
+func WithMaxDepth(depth int) SolveOption {
+	return solveOptionFunc(func(opts *SolveOptions) { opts.MaxDepth = depth })
+}
+
+// WithLimit limits the number of solutions, returning MaxSolutionsError when reached.
+func WithLimit(limit int) SolveOption {
+	return solveOptionFunc(func(opts *SolveOptions) { opts.Limit = limit })
+}
+
+// WithMaxInferences limits the number of goals executed, returning MaxInferencesError when
+// exceeded.
+func WithMaxInferences(inferences int) SolveOption {
+	return solveOptionFunc(func(opts *SolveOptions) { opts.MaxInferences = inferences })
+}
+
+// WithOccursCheck sets whether unification performs the occurs check.
+func WithOccursCheck(enabled bool) SolveOption {
+	return solveOptionFunc(func(opts *SolveOptions) { opts.OccursCheck = enabled })
+}
+
+// WithTrace prints each executed goal to w, indented by its depth of calls.
+func WithTrace(w io.Writer) SolveOption {
+	return solveOptionFunc(func(opts *SolveOptions) { opts.Trace = w })
+}
+
+// WithContext stops the search when the context is done, returning the context's error.
+func WithContext(ctx context.Context) SolveOption {
+	return solveOptionFunc(func(opts *SolveOptions) { opts.Context = ctx })
+}
+
+// newSolveOptions applies all options in order, and validates the result.
+func newSolveOptions(opts ...SolveOption) (SolveOptions, error) {
+	var o SolveOptions
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	if o.Context == nil {
+		o.Context = context.Background()
+	}
+	switch {
+	case o.MaxDepth < 0:
+		return SolveOptions{}, fmt.Errorf("invalid max depth: %d", o.MaxDepth)
+	case o.Limit < 0:
+		return SolveOptions{}, fmt.Errorf("invalid limit: %d", o.Limit)
+	case o.MaxInferences < 0:
+		return SolveOptions{}, fmt.Errorf("invalid max inferences: %d", o.MaxInferences)
+	}
+	return o, nil
+}
@@ -36,15 +36,20 @@ func dirFiles(dirName string) []string {
 	return names
 }
 
-func Prelude(opts ...any) *Database {
+// Prelude returns a database with the prelude library, interpreted with the given options.
+// It returns an error if the options are invalid, or if they prevent loading the library.
+func Prelude(opts ...SolveOption) (*Database, error) {
+	if _, err := newSolveOptions(opts...); err != nil {
+		return nil, err
+	}
 	db := Bootstrap()
 	for _, name := range dirFiles("lib/prelude") {
 		content := readLib(name)
 		if err := db.Interpret(content, opts...); err != nil {
-			panic(fmt.Sprintf("prelude library error! %s: %v", name, err))
+			return nil, fmt.Errorf("prelude library error! %s: %w", name, err)
 		}
 	}
-	return db
+	return db, nil
 }
 
 // --- Bootstrap parser ---
@@ -58,7 +63,12 @@ func Bootstrap() *Database {
 	return NewDatabase(rules...)
 }
 
-func Bootstrap2(opts ...any) *Database {
+// Bootstrap2 returns a database with the bootstrap library, parsed by the Go parser.
+// Options are validated as in Prelude, even though loading the library runs no queries.
+func Bootstrap2(opts ...SolveOption) (*Database, error) {
+	if _, err := newSolveOptions(opts...); err != nil {
+		return nil, err
+	}
 	var rules []Rule
 	for _, name := range dirFiles("lib/bootstrap") {
 		content := readLib(name)
@@ -69,7 +79,7 @@ func Bootstrap2(opts ...any) *Database {
 		}
 		rules = append(rules, newRules...)
 	}
-	return NewDatabase(rules...)
+	return NewDatabase(rules...), nil
 }
 
 type parser struct {
@@ -176,6 +186,10 @@ func (p *parser) term() (Term, bool) {
 		// Var
 		return x, true
 	}
+	if f, ok := p.float_(); ok {
+		// Float
+		return f, true
+	}
 	// Int
 	return p.int_()
 }
@@ -211,17 +225,29 @@ func (p *parser) atom() (Atom, bool) {
 	return Atom(""), false
 }
 
-func (p *parser) int_() (Int, bool) {
+func (p *parser) int_() (Term, bool) {
 	m := p.match2(`[0-9]+`)
 	if m == nil {
 		return Int(0), false
 	}
-	// Int
-	i, err := strconv.Atoi(m[0])
+	// Int or BigInt
+	i, err := ParseInt(m[0])
 	if err != nil {
 		return Int(0), false
 	}
-	return Int(i), true
+	return i, true
+}
+
+func (p *parser) float_() (Float, bool) {
+	m := p.match2(`[0-9]+\.[0-9]+([eE][+-]?[0-9]+)?`)
+	if m == nil {
+		return Float(0), false
+	}
+	f, err := strconv.ParseFloat(m[0], 64)
+	if err != nil {
+		return Float(0), false
+	}
+	return Float(f), true
 }
 
 func (p *parser) var_() (Var, bool) {
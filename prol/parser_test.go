@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"reflect"
+	"slices"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -25,7 +26,7 @@ func TestBootstrapParsesItself(t *testing.T) {
 		s("parse_database", v("Rules"), v("_Chars"), v("_Rest0")),
 		s("ws", v("_Rest0"), v("Rest")),
 	)
-	solution, err := db.FirstSolution(query, "max_depth", len(bootstrap)*10)
+	solution, err := db.FirstSolution(query, prol.WithMaxDepth(len(bootstrap)*10))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,7 +53,7 @@ func TestBootstrapParsesItself(t *testing.T) {
 	diff := cmp.Diff(db, compiledKB,
 		cmp.Exporter(exporter),
 		cmpopts.IgnoreUnexported(prol.Builtin{}),
-		cmpopts.IgnoreFields(prol.Database{}, "index1"))
+		cmpopts.IgnoreFields(prol.Database{}, "index1", "mu", "version", "shared"))
 	if diff != "" {
 		t.Errorf("difference between compilers (-want, +got):\n%s", diff)
 	}
@@ -67,11 +68,13 @@ var (
 	dcgFile string
 	//go:embed lib/prelude/04_expressions.pl
 	expressionsFile string
+	//go:embed lib/prelude/05_control.pl
+	controlFile string
 )
 
 func TestPreludeComments(t *testing.T) {
 	db := prol.Bootstrap()
-	err := db.Interpret(commentsFile, "max_depth", len(commentsFile)*10)
+	err := db.Interpret(commentsFile, prol.WithMaxDepth(len(commentsFile)*10))
 	if err != nil {
 		t.Errorf("comments error: %v", err)
 	}
@@ -155,7 +158,7 @@ func TestPreludeLists(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			opts := cmp.Options{
 				cmp.AllowUnexported(prol.Ref{}),
-				cmpopts.IgnoreFields(prol.Ref{}, "id"),
+				cmpopts.IgnoreFields(prol.Ref{}, "src", "id"),
 			}
 			db := db.Clone()
 			err := db.Interpret(test.content)
@@ -263,7 +266,7 @@ func TestPreludeDCG(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			opts := cmp.Options{
 				cmp.AllowUnexported(prol.Ref{}),
-				cmpopts.IgnoreFields(prol.Ref{}, "id"),
+				cmpopts.IgnoreFields(prol.Ref{}, "src", "id"),
 			}
 			db := db.Clone()
 			err := db.Interpret(test.content)
@@ -326,6 +329,47 @@ func TestPreludeExpressions(t *testing.T) {
 				v("T4"): s("+", int_(1), int_(2)),
 			},
 		},
+		{
+			"Parse arithmetic operators",
+			`test_parse_expr(1 =\= 2, 3 // 4 rem 5, 6 /\ 7 \/ 8).`,
+			clause(s("query"), s("test_parse_expr", v("T1"), v("T2"), v("T3"))),
+			prol.Solution{
+				v("T1"): s("=\\=", int_(1), int_(2)),
+				v("T2"): s("rem", s("//", int_(3), int_(4)), int_(5)),
+				v("T3"): s("\\/", s("/\\", int_(6), int_(7)), int_(8)),
+			},
+		},
+		{
+			"Parse word operators as whole identifiers",
+			`test_parse_expr(X, Y) :-
+               parse_expr(X, "a mod modulo", []),
+               \+(parse_expr(Y, "a module(b)", [])).`,
+			clause(s("query"), s("test_parse_expr", v("X"), v("Y"))),
+			prol.Solution{
+				v("X"): s("struct", a("mod"), fromList(s("atom", a("a")), s("atom", a("modulo")))),
+				v("Y"): ref("Y"),
+			},
+		},
+		{
+			"Parse constraint operators",
+			`test_parse_expr(a #= b + 1, c in 1 \/ 3, d #\= 2).`,
+			clause(s("query"), s("test_parse_expr", v("T1"), v("T2"), v("T3"))),
+			prol.Solution{
+				v("T1"): s("#=", a("a"), s("+", a("b"), int_(1))),
+				v("T2"): s("in", a("c"), s("\\/", int_(1), int_(3))),
+				v("T3"): s("#\\=", a("d"), int_(2)),
+			},
+		},
+		{
+			"Parse floats",
+			`test_parse_expr(1.5, 2.0e10, 3.25E-2).`,
+			clause(s("query"), s("test_parse_expr", v("T1"), v("T2"), v("T3"))),
+			prol.Solution{
+				v("T1"): float_(1.5),
+				v("T2"): float_(2e10),
+				v("T3"): float_(0.0325),
+			},
+		},
 		{
 			"Parse prefix",
 			`f(+ 2)`,
@@ -339,11 +383,15 @@ func TestPreludeExpressions(t *testing.T) {
 		},
 		// test_parse_expr(- -1, + -1, + +2).
 	}
+	// Logs and profiles are regenerated by each run, and are not tracked.
+	if err := os.MkdirAll("testoutput", 0o755); err != nil {
+		t.Fatalf("error creating output dir: %v", err)
+	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			opts := cmp.Options{
 				cmp.AllowUnexported(prol.Ref{}),
-				cmpopts.IgnoreFields(prol.Ref{}, "id"),
+				cmpopts.IgnoreFields(prol.Ref{}, "src", "id"),
 			}
 			db := db.Clone()
 			var err error
@@ -380,3 +428,134 @@ func TestPreludeExpressions(t *testing.T) {
 		})
 	}
 }
+
+func TestPreludeControl(t *testing.T) {
+	db := prol.Bootstrap()
+	err1 := db.Interpret(commentsFile)
+	err2 := db.Interpret(listsFile)
+	err3 := db.Interpret(dcgFile)
+	err4 := db.Interpret(expressionsFile)
+	err5 := db.Interpret(controlFile)
+	err := errors.Join(err1, err2, err3, err4, err5)
+	if err != nil {
+		t.Errorf("source error: %v", err)
+	}
+	tests := []struct {
+		name    string
+		content string
+		query   prol.Clause
+		want    []prol.Solution
+	}{
+		{
+			"Cut",
+			`test_cut(X) :- parse_list(X, "[1, 2]", []), !.
+             test_cut(none).`,
+			clause(s("query"), s("test_cut", v("X"))),
+			[]prol.Solution{
+				{v("X"): s("struct", a("."), fromList(
+					s("int", int_(1)),
+					s("struct", a("."), fromList(s("int", int_(2)), s("atom", a("[]"))))))},
+			},
+		},
+		{
+			"Operator goals",
+			`test_ops(X, Y) :- X = 1, \+ X >= 2, Y is X + 1.`,
+			clause(s("query"), s("test_ops", v("X"), v("Y"))),
+			[]prol.Solution{
+				{v("X"): int_(1), v("Y"): int_(2)},
+			},
+		},
+		{
+			"Control constructs",
+			`test_control(X, Y) :-
+               ( X = 1, fail
+               ; X = 2 -> Y = a
+               ; Y = b
+               ).`,
+			clause(s("query"), s("test_control", v("X"), v("Y"))),
+			[]prol.Solution{
+				{v("X"): int_(2), v("Y"): a("a")},
+			},
+		},
+		{
+			"Soft-cut",
+			`test_soft_cut(X) :- (test_soft_cut_(X) *-> true ; X = 0).
+             test_soft_cut_(1).
+             test_soft_cut_(2).`,
+			clause(s("query"), s("test_soft_cut", v("X"))),
+			[]prol.Solution{
+				{v("X"): int_(1)},
+				{v("X"): int_(2)},
+			},
+		},
+		{
+			"DCG after operator goals",
+			`test_dcg_rule --> [].`,
+			clause(s("query"), s("test_dcg_rule", a("[]"), v("X"))),
+			[]prol.Solution{
+				{v("X"): a("[]")},
+			},
+		},
+		{
+			"Cut as atom",
+			`test_cut_atom(!).`,
+			clause(s("query"), s("test_cut_atom", v("X"))),
+			[]prol.Solution{
+				{v("X"): a("!")},
+			},
+		},
+		{
+			"Loaded and dynamic predicates",
+			`:- dynamic(test_counter/1).
+             test_counter(0).
+             test_loaded(1).`,
+			clause(s("query"),
+				s("predicate_property", s("test_loaded", v("_")), v("P1")),
+				s("predicate_property", s("test_counter", v("_")), v("P2")),
+				s("\\=", v("P1"), a("defined")),
+				s("\\=", v("P2"), a("defined")),
+				s("atom", v("P1")),
+				s("atom", v("P2"))),
+			[]prol.Solution{
+				{v("P1"): a("static"), v("P2"): a("dynamic")},
+			},
+		},
+		{
+			"Modules",
+			`:- module(test_m1, [test_name/1]).
+             test_name(X) :- test_helper(X).
+             test_helper(one).
+             :- module(test_m2, [test_both/2]).
+             test_both(X, Y) :- test_m1:test_name(X), test_name(Y).
+             test_name(X) :- test_helper(X).
+             test_helper(two).`,
+			clause(s("query"),
+				s("use_module", a("test_m2")),
+				s("test_both", v("X"), v("Y"))),
+			[]prol.Solution{
+				{v("X"): a("one"), v("Y"): a("two")},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := cmp.Options{
+				cmp.AllowUnexported(prol.Ref{}),
+				cmpopts.IgnoreFields(prol.Ref{}, "src", "id"),
+			}
+			db := db.Clone()
+			err := db.Interpret(test.content)
+			if err != nil {
+				t.Errorf("test interpret err: %v", err)
+			}
+			seq, errFn := db.Solve(test.query)
+			got := slices.Collect(seq)
+			if err := errFn(); err != nil {
+				t.Fatalf("want solutions, got: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, opts...); diff != "" {
+				t.Errorf("(-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
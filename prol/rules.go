@@ -105,6 +105,36 @@ type Builtin struct {
 
 func (Builtin) isRule() {}
 
+// sameRule returns whether both rules are the same asserted rule, and not only equal.
+func sameRule(r1, r2 Rule) bool {
+	switch r1 := r1.(type) {
+	case Clause:
+		r2, ok := r2.(Clause)
+		return ok && &r1[0] == &r2[0]
+	case DCG:
+		r2, ok := r2.(DCG)
+		return ok && &r1.dcgGoals[0] == &r2.dcgGoals[0]
+	default:
+		return false
+	}
+}
+
+// clauseTerms returns the head and body of a renamed copy of the rule, with the body as a
+// conjunction term.
+func clauseTerms(rule Rule, newRef func(Var) *Ref) (Struct, Term) {
+	var c Clause
+	switch r := rule.(type) {
+	case Clause:
+		c = r
+	case DCG:
+		c = r.clause
+	default:
+		panic(fmt.Sprintf("rule type %T has no clause", rule))
+	}
+	c = varToRef(c, map[Var]*Ref{}, newRef).(Clause)
+	return c[0].Term, conjunction(c[1:])
+}
+
 // --- Indicator ---
 
 func (c Clause) Indicator() Indicator {
@@ -112,7 +142,7 @@ func (c Clause) Indicator() Indicator {
 }
 
 func (c DCG) Indicator() Indicator {
-	return Indicator{c.dcgGoals[0].Term.Name, len(c.dcgGoals[0].Term.Args) + 2}
+	return Indicator{Name: c.dcgGoals[0].Term.Name, Arity: len(c.dcgGoals[0].Term.Args) + 2}
 }
 
 func (c Builtin) Indicator() Indicator {
@@ -134,7 +164,7 @@ func (c DCG) ToAST() Term {
 	for i, goal := range c.dcgGoals[1:] {
 		bodyAST[i] = goal.Term.ToAST()
 	}
-	return Struct{"clause", []Term{c.dcgGoals[0].Term.ToAST(), FromList(bodyAST)}}
+	return Struct{"dcg", []Term{c.dcgGoals[0].Term.ToAST(), FromList(bodyAST)}}
 }
 
 func (c Builtin) ToAST() Term {
@@ -156,7 +186,7 @@ func isError(err error) ([]Goal, bool, error) {
 }
 
 func (c Clause) Unify(s Solver, goal Goal) ([]Goal, bool, error) {
-	c = varToRef(c, map[Var]*Ref{}).(Clause)
+	c = varToRef(c, map[Var]*Ref{}, s.NewRef).(Clause)
 	if ok := s.Unify(c[0].Term, goal.Term); !ok {
 		return isSuccess(false)
 	}
@@ -179,7 +209,7 @@ func goalString(goal Struct, isDCG bool) string {
 		return goal.Name.String()
 	}
 	// DCG list.
-	if isDCG && goal.Indicator() == (Indicator{".", 2}) {
+	if isDCG && goal.Indicator() == (Indicator{Name: ".", Arity: 2}) {
 		terms, tail := ToList(goal)
 		if tail == Nil {
 			return listToString(terms, tail)
@@ -0,0 +1,171 @@
+package prol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brunokim/prol-go/kif"
+)
+
+// --- Tabling ---
+//
+// Calls to tabled predicates are evaluated once for each variant, and their answers are
+// stored in a table. A call that is a variant of one being evaluated, like in left
+// recursion, doesn't execute the predicate's clauses again, but consumes the answers found
+// so far. The evaluating call executes the clauses repeatedly until no new answers are
+// found, when the table is complete.
+//
+// If a table consumes answers from an older table still being evaluated, its answers depend
+// on the older one, and they are part of the same strongly connected component (SCC). Such
+// tables are evaluated again on each iteration of the oldest table of the SCC, the leader,
+// and are completed all together when the leader reaches a fixpoint.
+
+type table struct {
+	answers []Term
+	// Variant keys of answers, to avoid duplicates.
+	keys map[string]bool
+	// Position in the solver's table stack, while being evaluated.
+	pos      int
+	complete bool
+	// Position of the oldest table being evaluated that this table depends on.
+	leader int
+	// Value of the solver's answer counter at the last evaluation.
+	round int
+}
+
+// variantKey returns a string that is equal for terms that are variants of each other.
+func variantKey(t Term) string {
+	var b strings.Builder
+	refs := make(map[*Ref]int)
+	var walk func(t Term)
+	walk = func(t Term) {
+		switch t := Deref(t).(type) {
+		case *Ref:
+			if _, ok := refs[t]; !ok {
+				refs[t] = len(refs)
+			}
+			fmt.Fprintf(&b, "_%d", refs[t])
+		case Struct:
+			fmt.Fprintf(&b, "%v(", t.Name)
+			for i, arg := range t.Args {
+				if i > 0 {
+					b.WriteRune(',')
+				}
+				walk(arg)
+			}
+			b.WriteRune(')')
+		default:
+			b.WriteString(t.String())
+		}
+	}
+	walk(t)
+	return b.String()
+}
+
+// tabledCall evaluates the goal's table if needed, and tries each of its answers as alternatives of a choice point.
+func (s *solver) tabledCall(goal Goal, ind Indicator, env *environment) (*environment, bool, error) {
+	key := variantKey(qualify(ind.Module, goal.Term))
+	t, ok := s.tables[key]
+	switch {
+	case !ok:
+		t = &table{keys: make(map[string]bool), pos: -1}
+		s.tables[key] = t
+		if err := s.evaluate(t, goal, ind); err != nil {
+			delete(s.tables, key)
+			return nil, false, err
+		}
+	case t.pos >= 0:
+		// Variant call of a table being evaluated: consume the answers found so far, and
+		// make all tables evaluated since then depend on it.
+		for _, u := range s.tableStack[t.pos:] {
+			u.leader = min(u.leader, t.pos)
+		}
+	case !t.complete && t.round != s.numAnswers:
+		// Table from the current SCC, that may have new answers since its last evaluation.
+		if err := s.evaluate(t, goal, ind); err != nil {
+			return nil, false, err
+		}
+	}
+	if !t.complete && len(s.tableStack) > 0 {
+		// Incomplete tables propagate their dependencies to the caller.
+		top := s.tableStack[len(s.tableStack)-1]
+		top.leader = min(top.leader, t.leader)
+	}
+	answers := t.answers
+	s.pushChoice(func(cp *choicePoint) (*environment, bool, error) {
+		for len(answers) > 0 {
+			s.restore(cp)
+			answer := answers[0]
+			answers = answers[1:]
+			cp.done = len(answers) == 0
+			if s.Unify(goal.Term, copyTerm(answer, make(map[*Ref]*Ref), s.NewRef)) {
+				return s.wake(env), true, nil
+			}
+		}
+		cp.done = true
+		return nil, false, nil
+	})
+	return nil, false, nil
+}
+
+// evaluate executes the goal's clauses until no new answers are found for its SCC.
+func (s *solver) evaluate(t *table, goal Goal, ind Indicator) error {
+	t.pos = len(s.tableStack)
+	s.tableStack = append(s.tableStack, t)
+	defer func() {
+		s.tableStack = s.tableStack[:t.pos]
+		t.pos = -1
+	}()
+	for {
+		t.leader = t.pos
+		t.round = s.numAnswers
+		results, err := s.FindAll(goal.Term, Struct{"$untabled", []Term{qualify(ind.Module, goal.Term)}})
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			key := variantKey(result)
+			if !t.keys[key] {
+				t.keys[key] = true
+				t.answers = append(t.answers, result)
+				s.numAnswers++
+			}
+		}
+		if t.leader < t.pos {
+			// Not the leader of its SCC, so it'll be evaluated again by the leader.
+			return nil
+		}
+		if t.round == s.numAnswers {
+			break
+		}
+	}
+	// Leader reached a fixpoint: complete all tables of its SCC.
+	for _, u := range s.tables {
+		if !u.complete && u.pos < 0 && u.leader >= t.pos {
+			u.complete = true
+		}
+	}
+	t.complete = true
+	s.db.Logger.Log(kif.DEBUG, kif.KV{"msg", "table complete"}, kif.KV{"goal", ind}, kif.KV{"answers", len(t.answers)})
+	return nil
+}
+
+// untabledControl executes the clauses of a tabled predicate, without consulting its table.
+func untabledControl(s *solver, goal Goal, cutBarrier int, env *environment) (*environment, bool, error) {
+	g, ind, err := toQualifiedGoal(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return nil, false, err
+	}
+	return s.resolve(g, ind, env)
+}
+
+func tableBuiltin(s Solver, goal Goal) ([]Goal, bool, error) {
+	inds, err := toIndicators(goal.Term.Args[0], goal.Term.Indicator())
+	if err != nil {
+		return isError(err)
+	}
+	for _, ind := range inds {
+		s.Table(ind)
+	}
+	return isSuccess(true)
+}
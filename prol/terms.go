@@ -2,8 +2,12 @@ package prol
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"unicode"
 	"unicode/utf8"
 )
@@ -23,6 +27,15 @@ type Atom string
 // Int is an atomic integral number.
 type Int int
 
+// BigInt is an atomic integral number that doesn't fit in an Int, stored as its decimal
+// representation.
+//
+// Use NewInt to create it, so that numbers that fit in an Int are always represented as Int.
+type BigInt string
+
+// Float is an atomic floating-point number.
+type Float float64
+
 // Var is a static-time variable.
 type Var string
 
@@ -34,13 +47,21 @@ type Struct struct {
 
 // Ref is a run-time variable.
 type Ref struct {
-	name  Var
+	name Var
+	// Source of the id: 0 for refs created with NewRef, or the number of the solver that
+	// created it, so that refs from different sources never share an id.
+	src   int64
 	id    int
 	Value Term
+	// Attributes by module, in order of insertion. The slice is never modified in place, so
+	// it can be restored on backtracking.
+	attrs []attribute
 }
 
 func (Atom) isTerm()   {}
 func (Int) isTerm()    {}
+func (BigInt) isTerm() {}
+func (Float) isTerm()  {}
 func (Var) isTerm()    {}
 func (Struct) isTerm() {}
 func (*Ref) isTerm()   {}
@@ -71,19 +92,57 @@ func MustVar(name string) Var {
 	return v
 }
 
+// NewInt creates an integer term from an arbitrary-precision integer, returning an Int if
+// it fits.
+func NewInt(x *big.Int) Term {
+	if x.IsInt64() && x.Int64() >= math.MinInt && x.Int64() <= math.MaxInt {
+		return Int(x.Int64())
+	}
+	return BigInt(x.String())
+}
+
+// ParseInt parses a decimal integer, returning an Int if it fits or a BigInt otherwise.
+func ParseInt(text string) (Term, error) {
+	if i, err := strconv.Atoi(text); err == nil {
+		return Int(i), nil
+	}
+	x, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer: %q", text)
+	}
+	return NewInt(x), nil
+}
+
+// Big returns the value of a BigInt as an arbitrary-precision integer.
+func (t BigInt) Big() *big.Int {
+	x, ok := new(big.Int).SetString(string(t), 10)
+	if !ok {
+		panic(fmt.Sprintf("invalid BigInt: %q", string(t)))
+	}
+	return x
+}
+
+// Big returns the value of an Int as an arbitrary-precision integer.
+func (t Int) Big() *big.Int {
+	return big.NewInt(int64(t))
+}
+
 // NewStruct creates a struct from the given parameters.
 func NewStruct(name string, terms ...Term) Struct {
 	return Struct{Atom(name), terms}
 }
 
-var (
-	refID = 0
-)
+// refID is the id of the last ref created outside of a solver. Refs created within a query
+// have ids allocated by its solver, so that concurrent queries don't share this counter, and
+// refs from exceptions are renamed by the solver before being caught.
+var refID atomic.Int64
+
+// numSolvers is the number of solvers created, used as the source of their ref ids.
+var numSolvers atomic.Int64
 
 // NewRef creates a fresh reference from the provided var.
 func NewRef(v Var) *Ref {
-	refID++
-	return &Ref{v, refID, nil}
+	return &Ref{name: v, id: int(refID.Add(1))}
 }
 
 // --- Indicator ---
@@ -92,14 +151,19 @@ func NewRef(v Var) *Ref {
 type Indicator struct {
 	Name  Atom
 	Arity int
+	// Module where the predicate is defined, or empty for the user module.
+	Module Atom
 }
 
 func (f Indicator) String() string {
+	if f.Module != "" {
+		return fmt.Sprintf("%v:%v/%d", f.Module, f.Name, f.Arity)
+	}
 	return fmt.Sprintf("%v/%d", f.Name, f.Arity)
 }
 
 func (s Struct) Indicator() Indicator {
-	return Indicator{s.Name, len(s.Args)}
+	return Indicator{Name: s.Name, Arity: len(s.Args)}
 }
 
 // --- ToAST ---
@@ -112,6 +176,14 @@ func (i Int) ToAST() Struct {
 	return Struct{"int", []Term{i}}
 }
 
+func (i BigInt) ToAST() Struct {
+	return Struct{"int", []Term{i}}
+}
+
+func (f Float) ToAST() Struct {
+	return Struct{"float", []Term{f}}
+}
+
 func (v Var) ToAST() Struct {
 	return Struct{"var", []Term{Atom(v)}}
 }
@@ -144,15 +216,30 @@ func (a Atom) IsChar() bool {
 // --- Conversion between term and list ---
 
 // ToList unwraps a linked list of cons cells into a list of terms.
+//
+// If the list is cyclic, the returned tail is a bound ref where the cycle was detected, and
+// terms contains at least one full cycle of elements.
 func ToList(t Term) (terms []Term, tail Term) {
-	s, ok := t.(Struct)
-	for ok && s.Name == "." && len(s.Args) == 2 {
+	// Brent's cycle detection over the refs in the list spine.
+	var mark *Ref
+	power, steps := 1, 0
+	for {
+		for ref, ok := t.(*Ref); ok && ref.Value != nil; ref, ok = t.(*Ref) {
+			if ref == mark {
+				return terms, ref
+			}
+			if steps++; steps == power {
+				mark, power, steps = ref, power*2, 0
+			}
+			t = ref.Value
+		}
+		s, ok := t.(Struct)
+		if !ok || s.Name != "." || len(s.Args) != 2 {
+			return terms, t
+		}
 		terms = append(terms, s.Args[0])
-		t = Deref(s.Args[1])
-		s, ok = t.(Struct)
+		t = s.Args[1]
 	}
-	tail = t
-	return
 }
 
 // FromList wraps the given list of terms into a linked list with a proper tail.
@@ -209,22 +296,164 @@ func Deref(t Term) Term {
 }
 
 // RefToTerm resolves all nested refs into ground terms, if possible.
+//
+// A cyclic term is returned as '@'(Template, Substitutions), where Substitutions is a list
+// of 'Var = Term' for each ref that is part of a cycle, like '@'(_S1, [_S1 = f(_S1)]).
 func RefToTerm(x Term) Term {
-	x = Deref(x)
-	if s, ok := x.(Struct); ok {
-		args := make([]Term, len(s.Args))
-		for i, arg := range s.Args {
-			args[i] = RefToTerm(arg)
+	r := &refResolver{onPath: make(map[*Ref]bool), names: make(map[*Ref]Var)}
+	t := r.resolve(x)
+	if len(r.subs) == 0 {
+		return t
+	}
+	return Struct{"@", []Term{t, FromList(r.subs)}}
+}
+
+type refResolver struct {
+	// Bound refs being currently resolved.
+	onPath map[*Ref]bool
+	// Names given to refs that are part of a cycle.
+	names map[*Ref]Var
+	subs  []Term
+}
+
+func (r *refResolver) resolve(x Term) Term {
+	switch x := x.(type) {
+	case *Ref:
+		if x.Value == nil {
+			return x
 		}
-		return Struct{s.Name, args}
+		if r.onPath[x] {
+			if _, ok := r.names[x]; !ok {
+				r.names[x] = Var(fmt.Sprintf("_S%d", len(r.names)+1))
+			}
+			return r.names[x]
+		}
+		r.onPath[x] = true
+		t := r.resolve(x.Value)
+		delete(r.onPath, x)
+		if name, ok := r.names[x]; ok {
+			r.subs = append(r.subs, Struct{"=", []Term{name, t}})
+			return name
+		}
+		return t
+	case Struct:
+		args := make([]Term, len(x.Args))
+		for i, arg := range x.Args {
+			args[i] = r.resolve(arg)
+		}
+		return Struct{x.Name, args}
+	default:
+		return x
+	}
+}
+
+// isAcyclic returns whether the term has no cycles through bound refs.
+func isAcyclic(t Term) bool {
+	onPath := make(map[*Ref]bool)
+	done := make(map[*Ref]bool)
+	var walk func(t Term) bool
+	walk = func(t Term) bool {
+		switch t := t.(type) {
+		case *Ref:
+			if t.Value == nil || done[t] {
+				return true
+			}
+			if onPath[t] {
+				return false
+			}
+			onPath[t] = true
+			if !walk(t.Value) {
+				return false
+			}
+			delete(onPath, t)
+			done[t] = true
+		case Struct:
+			for _, arg := range t.Args {
+				if !walk(arg) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return walk(t)
+}
+
+// copyTerm creates a copy of the term with fresh refs, resolving all bound refs.
+//
+// The refs map keeps the correspondence between refs in the original term and in the copy,
+// and fresh refs are created with newRef.
+// Bound refs that are part of a cycle are kept as bound refs in the copy, to preserve the cycle.
+func copyTerm(t Term, refs map[*Ref]*Ref, newRef func(Var) *Ref) Term {
+	switch t := t.(type) {
+	case *Ref:
+		if t.Value == nil {
+			if _, ok := refs[t]; !ok {
+				refs[t] = newRef(t.name)
+			}
+			return refs[t]
+		}
+		if x, ok := refs[t]; ok {
+			// Ref is being copied, so it's part of a cycle.
+			if x == nil {
+				x = newRef(t.name)
+				refs[t] = x
+			}
+			return x
+		}
+		refs[t] = nil
+		value := copyTerm(t.Value, refs, newRef)
+		if x := refs[t]; x != nil {
+			if x.Value == nil {
+				x.Value = value
+			}
+			return x
+		}
+		delete(refs, t)
+		return value
+	case Struct:
+		args := make([]Term, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = copyTerm(arg, refs, newRef)
+		}
+		return Struct{t.Name, args}
+	default:
+		return t
 	}
-	return x
+}
+
+// termVariables returns the unbound refs within the term, in depth-first order.
+func termVariables(t Term) []*Ref {
+	var refs []*Ref
+	// Bound refs are also marked as seen, so that cyclic terms are walked only once.
+	seen := make(map[*Ref]bool)
+	var walk func(t Term)
+	walk = func(t Term) {
+		switch t := t.(type) {
+		case *Ref:
+			if seen[t] {
+				return
+			}
+			seen[t] = true
+			if t.Value != nil {
+				walk(t.Value)
+			} else {
+				refs = append(refs, t)
+			}
+		case Struct:
+			for _, arg := range t.Args {
+				walk(arg)
+			}
+		}
+	}
+	walk(t)
+	return refs
 }
 
 // --- String ---
 
 var (
-	atomRE = regexp.MustCompile(`^([\p{Ll}][\pL\pN_]*|\[\]|[=<>+*/^\\-]+)$`)
+	atomRE = regexp.MustCompile(`^([\p{Ll}][\pL\pN_]*|\[\]|[=<>+*/^\\:@#-]+)$`)
 )
 
 func (t Atom) String() string {
@@ -238,16 +467,63 @@ func (t Int) String() string {
 	return fmt.Sprintf("%d", int(t))
 }
 
+func (t BigInt) String() string {
+	return string(t)
+}
+
+// String formats the float with the least number of digits that reads back as the same
+// number, always with a fractional part to distinguish it from an Int, like 1.0 or 1.5e-10.
+func (t Float) String() string {
+	f := float64(t)
+	switch {
+	case math.IsInf(f, +1):
+		return "1.0Inf"
+	case math.IsInf(f, -1):
+		return "-1.0Inf"
+	case math.IsNaN(f):
+		return "1.5NaN"
+	}
+	text := strconv.FormatFloat(f, 'g', -1, 64)
+	mantissa, exp, hasExp := strings.Cut(text, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	if !hasExp {
+		return mantissa
+	}
+	// Remove '+' sign and leading zeros from exponent.
+	sign := ""
+	if exp[0] == '-' {
+		sign = "-"
+	}
+	exp = strings.TrimLeft(exp[1:], "0")
+	return mantissa + "e" + sign + exp
+}
+
 func (t Var) String() string {
 	return string(t)
 }
 
+// String formats the struct, dereferencing bound refs as it goes.
+// Cyclic terms are resolved first, so that they are printed in their bounded
+// '@'(Template, Substitutions) form.
 func (t Struct) String() string {
-	terms, tail := ToList(t)
+	if isAcyclic(t) {
+		return resolvedToString(t)
+	}
+	return resolvedToString(RefToTerm(t))
+}
+
+func resolvedToString(t Term) string {
+	s, ok := t.(Struct)
+	if !ok {
+		return t.String()
+	}
+	terms, tail := ToList(s)
 	if len(terms) > 0 {
 		return listToString(terms, tail)
 	}
-	return structToString(t)
+	return structToString(s)
 }
 
 func structToString(t Struct) string {
@@ -267,7 +543,7 @@ func commaSeparated(b *strings.Builder, terms []Term) {
 		if i > 0 {
 			b.WriteString(", ")
 		}
-		b.WriteString(Deref(term).String())
+		b.WriteString(resolvedToString(Deref(term)))
 	}
 }
 
@@ -278,7 +554,7 @@ func listToString(terms []Term, tail Term) string {
 		b.WriteRune('[')
 		commaSeparated(&b, terms)
 		b.WriteRune('|')
-		b.WriteString(tail.String())
+		b.WriteString(resolvedToString(tail))
 		b.WriteRune(']')
 		return b.String()
 	}
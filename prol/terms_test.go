@@ -0,0 +1,53 @@
+package prol_test
+
+import (
+	"testing"
+
+	"github.com/brunokim/prol-go/prol"
+)
+
+func TestCyclicTerms(t *testing.T) {
+	// X = f(X)
+	x := ref("X")
+	x.Value = s("f", x)
+	// L = [a|L]
+	l := ref("L")
+	l.Value = s(".", a("a"), l)
+	// Y = [bb, cc]
+	y := ref("Y")
+	y.Value = s(".", a("bb"), s(".", a("cc"), a("[]")))
+
+	tests := []struct {
+		name string
+		term prol.Term
+		want string
+	}{
+		{"Cyclic struct", s("g", x), "@(g(_S1), [=(_S1, f(_S1))])"},
+		{"Cyclic list", l.Value, "@([a|_S1], [=(_S1, [a|_S1])])"},
+		{"Bound acyclic refs", s("g", y, s("h", y)), "g([bb, cc], h([bb, cc]))"},
+		{"Shared acyclic term", s("g", s("h", x.Value), a("b")), "@(g(h(f(_S1)), b), [=(_S1, f(_S1))])"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := prol.RefToTerm(test.term).String(); got != test.want {
+				t.Errorf("RefToTerm(%s).String(): want %q, got %q", test.name, test.want, got)
+			}
+			if got := test.term.String(); got != test.want {
+				t.Errorf("%s.String(): want %q, got %q", test.name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestToListCyclic(t *testing.T) {
+	// L = [a, b|L]
+	l := ref("L")
+	l.Value = s(".", a("a"), s(".", a("b"), l))
+	terms, tail := prol.ToList(l.Value)
+	if len(terms) < 2 {
+		t.Errorf("want at least one cycle of elements, got %v", terms)
+	}
+	if ref, ok := tail.(*prol.Ref); !ok || ref.Value == nil {
+		t.Errorf("want bound ref as tail, got %v", tail)
+	}
+}